@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Role is a role of the telegram user or chat
+type Role string
+
+const (
+	// RoleOwner has access to all commands, clients and accounts
+	RoleOwner Role = "owner"
+	// RoleViewer can see balances and reports of the allowed clients and accounts
+	RoleViewer Role = "viewer"
+	// RoleNotifier only receives notifications of the allowed clients and accounts
+	RoleNotifier Role = "notifier"
+)
+
+// defaultRoleCommands are the commands allowed to the roles, they can be changed in the configuration file
+var defaultRoleCommands = map[Role][]string{
+	RoleOwner:    {"balance", "report", "receipts", "search", "rules", "rule", "delete_rule", "get_webhook", "set_webhook", "reload", "invite", "revoke", "connect", "disconnect", "share", "unshare"},
+	RoleViewer:   {"balance", "report", "receipts", "search", "connect", "disconnect", "share", "unshare"},
+	RoleNotifier: {},
+}
+
+// AccessConfig is a role of the telegram user or chat with the visible clients and accounts
+type AccessConfig struct {
+	ID       int64    `yaml:"id"` // id of the user or the chat
+	Role     Role     `yaml:"role"`
+	Clients  []string `yaml:"clients"`  // aliases or numbers of the visible clients, all if empty
+	Accounts []string `yaml:"accounts"` // ids of the visible accounts, all accounts of the clients if empty
+
+	Chat int64 `yaml:"-" json:"-"` // the chat of the update, it is set by resolve
+}
+
+// access is a set of the roles of the users and chats
+type access struct {
+	grants     map[int64]AccessConfig
+	configured map[int64]bool // the roles from the configuration, they can not be changed by the commands
+	commands   map[Role]map[string]bool
+}
+
+// newAccess returns the access by the configuration, TELEGRAM_ADMINS are owners and TELEGRAM_CHATS are viewers
+func newAccess(config Config) (*access, error) {
+	a := &access{
+		grants:     map[int64]AccessConfig{},
+		configured: map[int64]bool{},
+		commands:   map[Role]map[string]bool{},
+	}
+
+	for role, commands := range defaultRoleCommands {
+		if override, ok := config.Roles[role]; ok {
+			commands = override
+		}
+
+		a.commands[role] = map[string]bool{}
+		for _, command := range commands {
+			a.commands[role][command] = true
+		}
+	}
+
+	for role := range config.Roles {
+		if _, ok := defaultRoleCommands[role]; !ok {
+			return nil, fmt.Errorf("config: unknown role %s", role)
+		}
+	}
+
+	for _, id := range config.TelegramChats {
+		a.grants[id] = AccessConfig{ID: id, Role: RoleViewer}
+	}
+
+	for _, id := range config.TelegramAdmins {
+		a.grants[id] = AccessConfig{ID: id, Role: RoleOwner}
+	}
+
+	for _, grant := range config.Access {
+		if _, ok := a.commands[grant.Role]; !ok {
+			return nil, fmt.Errorf("config: access %d, unknown role %s", grant.ID, grant.Role)
+		}
+
+		a.grants[grant.ID] = grant
+	}
+
+	for id := range a.grants {
+		a.configured[id] = true
+	}
+
+	return a, nil
+}
+
+// withGrants returns a copy of the access with the roles granted by the invites,
+// the roles from the configuration take precedence.
+func (a *access) withGrants(grants []AccessConfig) *access {
+	c := &access{
+		grants:     make(map[int64]AccessConfig, len(a.configured)+len(grants)),
+		configured: a.configured,
+		commands:   a.commands,
+	}
+
+	for id := range a.configured {
+		c.grants[id] = a.grants[id]
+	}
+
+	for _, grant := range grants {
+		if !a.configured[grant.ID] {
+			c.grants[grant.ID] = grant
+		}
+	}
+
+	return c
+}
+
+// isRole checks the role is known
+func (a *access) isRole(role Role) bool {
+	_, ok := a.commands[role]
+	return ok
+}
+
+// resolve returns the access in the chat, the private chat has the role of the user and a group chat
+// has only its own role, the roles of the members are not used, so the chat shows only what is allowed to the chat.
+func (a *access) resolve(chatID int64) (AccessConfig, bool) {
+	grant, ok := a.grants[chatID]
+	grant.Chat = chatID
+	return grant, ok
+}
+
+// can checks the command is allowed to the role of the access
+func (a *access) can(grant AccessConfig, command string) bool {
+	return a.commands[grant.Role][command]
+}
+
+// owners returns ids of the owners
+func (a *access) owners() []int64 {
+	ids := []int64{}
+	for id, grant := range a.grants {
+		if grant.Role == RoleOwner {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// recipients returns ids of the users and chats which can see the account of the client
+func (a *access) recipients(client Client, index int, accountID string) []int64 {
+	ids := []int64{}
+	for id, grant := range a.grants {
+		if grant.canSeeAccount(client, index, accountID) {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// canSeeClient checks the client is visible, the client is matched by the alias or the number
+func (g AccessConfig) canSeeClient(client Client, index int) bool {
+	if g.Role == RoleOwner || len(g.Clients) == 0 {
+		return true
+	}
+
+	for _, ref := range g.Clients {
+		if ref == client.GetAlias() || ref == fmt.Sprint(index) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canSeeAccount checks the account of the client is visible
+func (g AccessConfig) canSeeAccount(client Client, index int, accountID string) bool {
+	if !g.canSeeClient(client, index) {
+		return false
+	}
+
+	if g.Role == RoleOwner || len(g.Accounts) == 0 {
+		return true
+	}
+
+	return contains(g.Accounts, accountID)
+}
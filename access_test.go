@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+func newTestAccess(t *testing.T) *access {
+	a, err := newAccess(Config{
+		TelegramAdmins: []int64{1},
+		TelegramChats:  []int64{-1},
+		Access: []AccessConfig{
+			{ID: -2, Role: RoleViewer, Clients: []string{"family"}, Accounts: []string{"joint"}},
+			{ID: 3, Role: RoleNotifier, Clients: []string{"0"}},
+		},
+		Roles: map[Role][]string{RoleViewer: {"balance"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a
+}
+
+func TestAccessResolve(t *testing.T) {
+	a := newTestAccess(t)
+
+	var tests = []struct {
+		userID   int64
+		chatID   int64
+		expected Role
+	}{
+		{1, 1, RoleOwner},
+		{1, -2, RoleViewer},
+		{1, -100, ""},
+		{2, -1, RoleViewer},
+		{3, 3, RoleNotifier},
+		{2, 2, ""},
+	}
+
+	for _, test := range tests {
+		grant, _ := a.resolve(test.chatID)
+		if grant.Role != test.expected {
+			t.Error("user", test.userID, "chat", test.chatID, "expected", test.expected, "got", grant.Role)
+		}
+	}
+}
+
+func TestAccessCan(t *testing.T) {
+	a := newTestAccess(t)
+
+	var tests = []struct {
+		role     Role
+		command  string
+		expected bool
+	}{
+		{RoleOwner, "set_webhook", true},
+		{RoleViewer, "balance", true},
+		{RoleViewer, "report", false},
+		{RoleViewer, "set_webhook", false},
+		{RoleNotifier, "balance", false},
+		{RoleOwner, callbackCommand("rs"), true},
+		{RoleViewer, callbackCommand("rk"), false},
+		{RoleViewer, callbackCommand("bc"), true},
+	}
+
+	for _, test := range tests {
+		if a.can(AccessConfig{Role: test.role}, test.command) != test.expected {
+			t.Error("role", test.role, "command", test.command, "expected", test.expected)
+		}
+	}
+
+	if _, err := newAccess(Config{Access: []AccessConfig{{ID: 1, Role: "admin"}}}); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+func TestAccessRecipients(t *testing.T) {
+	a := newTestAccess(t)
+
+	personal := &client{alias: "personal", limiter: rate.NewLimiter(0, 0)}
+	family := &client{alias: "family", limiter: rate.NewLimiter(0, 0)}
+
+	var tests = []struct {
+		client   Client
+		index    int
+		account  string
+		expected []int64
+	}{
+		{personal, 0, "acc", []int64{-1, 1, 3}},
+		{family, 1, "joint", []int64{-2, -1, 1}},
+		{family, 1, "acc", []int64{-1, 1}},
+	}
+
+	for _, test := range tests {
+		ids := a.recipients(test.client, test.index, test.account)
+		if len(ids) != len(test.expected) {
+			t.Error("Expected ", test.expected, ", got ", ids)
+			continue
+		}
+
+		for i := range ids {
+			if ids[i] != test.expected[i] {
+				t.Error("Expected ", test.expected, ", got ", ids)
+			}
+		}
+	}
+}
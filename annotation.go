@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	annotationsBucket = "annotations"
+	messagesBucket    = "messages"
+
+	// the notifications older than the ttl can not be annotated by a reply
+	messageRefTTL = 90 * 24 * time.Hour
+)
+
+// Annotation is the note and the tags of the statement item added by the users
+type Annotation struct {
+	Note string   `json:"note,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+// messageRef links the sent notification to its statement item
+type messageRef struct {
+	ClientID    uint32    `json:"clientId"`
+	Account     string    `json:"account"`
+	StatementID string    `json:"statementId"`
+	Time        int       `json:"time"` // the time of the statement item
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+func messageRefKey(chatID int64, messageID int) string {
+	return fmt.Sprintf("%d:%d", chatID, messageID)
+}
+
+// parseAnnotation splits the text into the note and the lowercase #tags, example: "hotel #vacation #Rome"
+func parseAnnotation(text string) Annotation {
+	annotation := Annotation{}
+
+	words := []string{}
+	for _, word := range strings.Fields(text) {
+		tag := strings.TrimRightFunc(word, unicode.IsPunct)
+		if len(tag) > 1 && strings.HasPrefix(tag, "#") {
+			annotation.Tags = appendTag(annotation.Tags, strings.ToLower(tag[1:]))
+			continue
+		}
+		words = append(words, word)
+	}
+	annotation.Note = strings.Join(words, " ")
+
+	return annotation
+}
+
+// appendTag adds the tag if it is not in the tags
+func appendTag(tags []string, tag string) []string {
+	if contains(tags, tag) {
+		return tags
+	}
+
+	return append(tags, tag)
+}
+
+// merge adds the tags and replaces the note if it is set
+func (a Annotation) merge(update Annotation) Annotation {
+	if update.Note != "" {
+		a.Note = update.Note
+	}
+
+	for _, tag := range update.Tags {
+		a.Tags = appendTag(a.Tags, tag)
+	}
+
+	return a
+}
+
+// saveMessageRef links the sent notification to the statement item to annotate it by a reply
+func (b *bot) saveMessageRef(message tgbotapi.Message, ref messageRef) error {
+	ref.ExpiresAt = time.Now().Add(messageRefTTL)
+
+	return b.storage.Put(messagesBucket, messageRefKey(message.Chat.ID, message.MessageID), ref)
+}
+
+// getMessageRef returns the statement item of the notification
+func (b *bot) getMessageRef(message *tgbotapi.Message) (messageRef, bool) {
+	var ref messageRef
+	ok, err := b.storage.Get(messagesBucket, messageRefKey(message.Chat.ID, message.MessageID), &ref)
+	if err != nil {
+		log.Error().Err(err).Msg("[annotation] get message")
+		return ref, false
+	}
+
+	return ref, ok && time.Now().Before(ref.ExpiresAt)
+}
+
+// getAnnotation returns the annotation of the statement item
+func (b *bot) getAnnotation(statementID string) (Annotation, error) {
+	var annotation Annotation
+	_, err := b.storage.Get(annotationsBucket, statementID, &annotation)
+
+	return annotation, err
+}
+
+// annotateItems sets the notes, the tags and the number of the receipts of the items
+func (b *bot) annotateItems(items []StatementItem) {
+	for i := range items {
+		annotation, err := b.getAnnotation(items[i].ID)
+		if err != nil {
+			log.Error().Err(err).Msg("[annotation] get annotation")
+			continue
+		}
+
+		items[i].Note = annotation.Note
+		items[i].Tags = annotation.Tags
+
+		receipts, err := b.getReceipts(items[i].ID)
+		if err != nil {
+			log.Error().Err(err).Msg("[annotation] get receipts")
+			continue
+		}
+
+		items[i].Receipts = len(receipts.Files)
+	}
+}
+
+// annotate saves the text of the reply to the notification as the note and the tags of its statement item,
+// false is returned if the message is not a reply to a notification
+func (b *bot) annotate(c commandContext) bool {
+	reply := c.Message.ReplyToMessage
+	if reply == nil || strings.TrimSpace(c.Message.Text) == "" {
+		return false
+	}
+
+	ref, ok := b.getMessageRef(reply)
+	if !ok {
+		return false
+	}
+
+	client, err := b.getClientByID(ref.ClientID)
+	if err != nil || !b.canSeeAccount(c.Grant, client, ref.Account) {
+		b.denyAccess(tgbotapi.Update{Message: c.Message}, true)
+		return true
+	}
+
+	annotation, err := b.getAnnotation(ref.StatementID)
+	if err != nil {
+		log.Error().Err(err).Msg("[annotation] get annotation")
+		b.reply(c.Message, T(c.Lang, "error"))
+		return true
+	}
+
+	annotation = annotation.merge(parseAnnotation(c.Message.Text))
+	if err := b.storage.Put(annotationsBucket, ref.StatementID, annotation); err != nil {
+		log.Error().Err(err).Msg("[annotation] save annotation")
+		b.reply(c.Message, T(c.Lang, "error"))
+		return true
+	}
+
+	client.GetReport(ref.Account).UpdateItem(ref.StatementID, func(item *StatementItem) {
+		item.Note = annotation.Note
+		item.Tags = annotation.Tags
+	})
+
+	b.reply(c.Message, T(c.Lang, "annotation_saved", formatTags(annotation.Tags)))
+	return true
+}
+
+// formatTags returns the tags with #, example: #vacation #rome
+func formatTags(tags []string) string {
+	if len(tags) == 0 {
+		return "-"
+	}
+
+	return "#" + strings.Join(tags, " #")
+}
+
+// pruneMessageRefs removes the links of the expired notifications
+func (b *bot) pruneMessageRefs(now time.Time) error {
+	return b.storage.Update(func(tx StorageTx) error {
+		expired := []string{}
+		err := tx.ForEach(messagesBucket, func(key string, value []byte) error {
+			var ref messageRef
+			if err := json.Unmarshal(value, &ref); err != nil || now.After(ref.ExpiresAt) {
+				expired = append(expired, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, key := range expired {
+			if err := tx.Delete(messagesBucket, key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
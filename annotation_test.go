@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestParseAnnotation(t *testing.T) {
+	var tests = []struct {
+		text     string
+		expected Annotation
+	}{
+		{"hotel #Vacation #rome, #vacation", Annotation{Note: "hotel", Tags: []string{"vacation", "rome"}}},
+		{"#rent", Annotation{Tags: []string{"rent"}}},
+		{"dinner with # friends", Annotation{Note: "dinner with # friends"}},
+	}
+
+	for _, test := range tests {
+		if annotation := parseAnnotation(test.text); !reflect.DeepEqual(annotation, test.expected) {
+			t.Error("For", test.text, "expected", test.expected, "got", annotation)
+		}
+	}
+
+	merged := Annotation{Note: "hotel", Tags: []string{"vacation"}}.merge(Annotation{Tags: []string{"rome", "vacation"}})
+	if !reflect.DeepEqual(merged, Annotation{Note: "hotel", Tags: []string{"vacation", "rome"}}) {
+		t.Error("Expected the note and the merged tags, got ", merged)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	b := newTestInviteBot(t)
+
+	client := NewClient(ClientConfig{Alias: "family"})
+	b.setClients([]Client{client}, map[uint32]*clientSettings{client.GetID(): {}})
+
+	// the cached report gets the annotation without a new request
+	update := newTestReportUpdate("1:rp:AAAAAAAA:0:1")
+	client.GetReport("account").SetGridData(update, []StatementItem{{ID: "st1"}, {ID: "st2"}})
+
+	notification := tgbotapi.Message{MessageID: 7, Chat: &tgbotapi.Chat{ID: 2}}
+	if err := b.saveMessageRef(notification, messageRef{ClientID: client.GetID(), Account: "account", StatementID: "st1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reply := func(text string, replyTo *tgbotapi.Message) bool {
+		return b.annotate(commandContext{
+			Message: &tgbotapi.Message{Text: text, Chat: &tgbotapi.Chat{ID: 2}, From: &tgbotapi.User{ID: 2}, ReplyToMessage: replyTo},
+			Grant:   AccessConfig{Role: RoleOwner},
+			Lang:    LangEN,
+		})
+	}
+
+	if !reply("hotel #vacation", &notification) || !reply("#rome", &notification) {
+		t.Fatal("Expected the annotation of the notification")
+	}
+
+	if reply("text", &tgbotapi.Message{MessageID: 8, Chat: &tgbotapi.Chat{ID: 2}}) {
+		t.Error("Expected no annotation of the unknown message")
+	}
+
+	annotation, err := b.getAnnotation("st1")
+	if err != nil || !reflect.DeepEqual(annotation, Annotation{Note: "hotel", Tags: []string{"vacation", "rome"}}) {
+		t.Error("Expected the saved annotation, got ", annotation, err)
+	}
+
+	r := client.GetReport("account").(*report)
+	items := filterByTag(r.cache[r.getCacheKay(update)], "rome")
+	if len(items) != 1 || items[0].Note != "hotel" {
+		t.Error("Expected the annotated item in the report, got ", items)
+	}
+
+	if err := b.pruneMessageRefs(time.Now().Add(messageRefTTL + time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	if reply("#late", &notification) {
+		t.Error("Expected no annotation of the expired notification")
+	}
+}
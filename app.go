@@ -1,18 +1,38 @@
 package main
 
 import (
+	"context"
+	"io/ioutil"
 	"os"
+	"os/signal"
+	"syscall"
 
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/rs/zerolog/pkgerrors"
+	"gopkg.in/yaml.v3"
 )
 
 func main() {
-	bot := New(
-		os.Getenv("TELEGRAM_ADMINS"),
-		os.Getenv("TELEGRAM_CHATS"),
-	)
+	// the loaded secrets are replaced with *** in the logs
+	log.Logger = log.Output(logRedactor)
+	tgbotapi.SetLogger(newTelegramLogger(logRedactor))
+
+	if len(os.Args) > 1 && os.Args[1] == "encrypt-secrets" {
+		encryptSecrets()
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		healthcheck()
+		return
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		log.Fatal().Err(err).Msg("[config] load")
+	}
 
 	// default level is info, unless debug flag is present
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
@@ -26,15 +46,75 @@ func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 
+	bot := New(config)
+
 	// init clients
-	err := bot.InitMonoClients(os.Getenv("MONO_TOKENS"))
+	err = bot.InitMonoClients(config.ClientConfigs())
+	if err != nil {
+		log.Fatal().Err(err).Msg("[monoapi] init clients")
+	}
+
+	defer bot.Close()
+
+	// stop on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// reload the configuration on SIGHUP
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := bot.Reload(); err != nil {
+				log.Error().Err(err).Msg("[config] reload")
+			}
+		}
+	}()
+
+	// run telegram, processing and http server until the signal
+	bot.Run(ctx, config.TelegramToken)
+
+	log.Info().Msg("stopped")
+}
+
+// healthcheck checks the liveness probe of the running bot with the address and TLS of the configuration,
+// it is the HEALTHCHECK of the docker image, example: mono_personal_tgbot healthcheck.
+// Only the http section is loaded, the probe runs often and the secrets are not decrypted for it.
+func healthcheck() {
+	config, err := LoadHTTPConfig()
+	if err != nil {
+		log.Fatal().Err(err).Msg("[config] load")
+	}
+
+	if err := checkHealth(config); err != nil {
+		log.Fatal().Err(err).Msg("[http] healthcheck")
+	}
+}
+
+// encryptSecrets encrypts the secrets yaml from stdin to stdout with the SECRETS_PASSPHRASE passphrase,
+// example: SECRETS_PASSPHRASE=... mono_personal_tgbot encrypt-secrets < secrets.yaml > secrets.enc
+func encryptSecrets() {
+	passphrase, err := getEnvSecret("SECRETS_PASSPHRASE")
 	if err != nil {
-		log.Panic().Err(err)
+		log.Fatal().Err(err).Msg("[secrets] passphrase")
 	}
 
-	go bot.TelegramStart(os.Getenv("TELEGRAM_TOKEN"))
-	go bot.ProcessingStart()
+	data, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		log.Fatal().Err(err).Msg("[secrets] read")
+	}
+
+	// check the format before encrypting
+	if err := yaml.Unmarshal(data, &Secrets{}); err != nil {
+		log.Fatal().Err(err).Msg("[secrets] parse")
+	}
 
-	// run http server
-	bot.WebhookStart()
+	encrypted, err := EncryptSecrets(data, passphrase)
+	if err != nil {
+		log.Fatal().Err(err).Msg("[secrets] encrypt")
+	}
+
+	if _, err := os.Stdout.Write(encrypted); err != nil {
+		log.Fatal().Err(err).Msg("[secrets] write")
+	}
 }
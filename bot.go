@@ -1,17 +1,21 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"html/template"
 	"io/ioutil"
+	"net"
 	"net/http"
-	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
@@ -28,512 +32,1272 @@ type StatementItemData struct {
 
 // Bot is the interface representing bot object.
 type Bot interface {
-	InitMonoClients(monoTokens string) error
-	TelegramStart(token string)
-	WebhookStart()
-	ProcessingStart()
+	InitMonoClients(configs []ClientConfig) error
+	Reload() error
+	TelegramStart(ctx context.Context, token string) error
+	WebhookStart(ctx context.Context) error
+	ProcessingStart(ctx context.Context) error
+	WebhookCheckStart(ctx context.Context) error
+	Run(ctx context.Context, token string)
+	Close()
 }
 
+const (
+	// shutdownTimeout is a time to wait for the http server shutdown
+	shutdownTimeout = 10 * time.Second
+
+	// webhookMaxBodySize is a limit of the monobank webhook body
+	webhookMaxBodySize = 64 << 10
+)
+
 // bot is implementation the Bot interface
 type bot struct {
-	telegramAdmins string
-	telegramChats  string
-	clients        []Client
+	// mu guards the fields rebuilt by the reload
+	mu          sync.RWMutex
+	access      *access
+	clients     []Client
+	userClients []Client // the clients connected by the users in the multi-tenant mode
+	settings    map[uint32]*clientSettings
+	connecting  map[int64]time.Time // the users sending a token after /connect
+
+	multiTenant   bool
+	userTokensKey string
+
+	receiptsDir string         // the local copies of the receipts are not saved if it is empty
+	downloads   sync.WaitGroup // the receipts being downloaded in the background
+
+	receiptsArchives chan struct{} // the archives of the receipts being built, see receiptsArchiveWorkers
+
+	lang     Lang           // the default language of the chats
+	location *time.Location // the default timezone of the chats
+
+	webhookSecret string
 
-	BotAPI *tgbotapi.BotAPI
+	httpConfig     HTTPConfig
+	trustedProxies []*net.IPNet
 
-	ch chan StatementItemData
+	// the monobank webhooks are registered automatically if the public url is set
+	publicURL            string
+	webhookCheckInterval time.Duration
 
+	// botAPI is created once by the first start of telegram, the handlers and the goroutines read it by getBotAPI
+	botAPIMu sync.RWMutex
+	botAPI   *tgbotapi.BotAPI
+
+	// telegram webhook mode is used instead of the long polling if the url is set
+	telegramWebhookURL    string
+	telegramWebhookSecret string
+	telegramUpdates       chan tgbotapi.Update
+
+	storage Storage
+	queue   Queue
+	notify  chan struct{}
+
+	publisher Publisher
+
+	metricsEnabled  bool
+	metricsBalances bool
+
+	health *health
+
+	templates *Templates
+}
+
+// clientSettings is a configuration of the client with the compiled template overrides
+type clientSettings struct {
+	config        ClientConfig
+	index         int     // a number of the client in commands
+	owner         int64   // the user of the client connected by /connect
+	shared        []int64 // the chats the user shares the client with
 	statementTmpl *template.Template
 	balanceTmpl   *template.Template
-	webhookTmpl   *template.Template
 }
 
 // New returns a bot object.
-func New(telegramAdmins, telegramChats string) Bot {
+func New(config Config) Bot {
 
-	statementTmpl, err := GetTempate(statementTemplate)
+	templates, err := LoadTemplates(config.TemplatesDir)
 	if err != nil {
 		log.Fatal().Err(err).Msg("[template]")
 	}
 
-	balanceTmpl, err := GetTempate(balanceTemplate)
+	location, err := loadLocation(config.Timezone)
 	if err != nil {
-		log.Fatal().Err(err).Msg("[template]")
+		log.Fatal().Err(err).Msg("[timezone]")
 	}
 
-	webhookTmpl, err := GetTempate(webhookTemplate)
-	if err != nil {
-		log.Fatal().Err(err).Msg("[template]")
+	// the webhook check is the only user of the public url
+	publicURL := config.PublicURL
+	if !config.Features.WebhookCheck {
+		publicURL = ""
 	}
 
 	b := bot{
-		telegramAdmins: telegramAdmins,
-		telegramChats:  telegramChats,
+		webhookSecret: config.WebhookSecret,
+
+		multiTenant:   config.MultiTenant,
+		userTokensKey: config.UserTokensKey,
+		connecting:    map[int64]time.Time{},
+
+		receiptsDir: config.ReceiptsDir,
+
+		lang:     config.Language,
+		location: location,
+
+		httpConfig: config.HTTP,
+
+		publicURL:            publicURL,
+		webhookCheckInterval: config.WebhookCheckInterval,
+
+		telegramWebhookURL:    config.TelegramWebhookURL,
+		telegramWebhookSecret: config.TelegramWebhookSecret,
+		telegramUpdates:       make(chan tgbotapi.Update, 100),
+
+		notify: make(chan struct{}, 1),
+
+		receiptsArchives: make(chan struct{}, receiptsArchiveWorkers),
+
+		templates: templates,
+
+		metricsEnabled:  config.Features.Metrics,
+		metricsBalances: config.Features.Metrics && config.Metrics.Balances,
 
-		ch: make(chan StatementItemData, 100),
+		health: newHealth("telegram", "webhook", "processing", "storage"),
+	}
+
+	if b.telegramWebhookURL != "" && b.telegramWebhookSecret == "" {
+		b.telegramWebhookSecret = randomSecret()
+	}
+
+	b.trustedProxies, err = parseTrustedProxies(config.HTTP.TrustedProxies)
+	if err != nil {
+		log.Fatal().Err(err).Msg("[http] trusted proxies")
+	}
 
-		statementTmpl: statementTmpl,
-		balanceTmpl:   balanceTmpl,
-		webhookTmpl:   webhookTmpl,
+	storage, err := NewStorage(config.StoragePath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("[storage] open")
+	}
+	b.storage = storage
+	b.queue = NewQueue(storage)
+
+	b.access, err = b.loadAccess(config)
+	if err != nil {
+		log.Fatal().Err(err).Msg("[access]")
+	}
+
+	registerQueueDepth(b.queue.Len)
+
+	if b.metricsBalances {
+		registerAccountBalance()
+	}
+
+	if config.Features.MQTT && config.MQTT.Broker != "" {
+		publisher, err := NewMQTTPublisher(config.MQTT)
+		if err != nil {
+			log.Fatal().Err(err).Msg("[mqtt] connect")
+		}
+		b.publisher = publisher
 	}
 
 	return &b
 }
 
 // InitMonoClients gets needed client data for correct working of the bot
-func (b *bot) InitMonoClients(monoTokens string) error {
+func (b *bot) InitMonoClients(configs []ClientConfig) error {
+	clients, settings, err := b.buildClients(configs)
+	if err != nil {
+		return err
+	}
 
-	monoTokensArr := strings.Split(monoTokens, ",")
+	b.setClients(clients, settings)
 
-	// init clients
-	clients := make([]Client, 0, len(monoTokensArr))
-	for _, monoToken := range monoTokensArr {
+	if b.multiTenant {
+		return b.loadUserClients()
+	}
 
-		client := NewClient(monoToken)
-		if err := client.Init(); err != nil {
-			return err
+	return nil
+}
+
+// Reload reloads the configuration and rebuilds the clients, the roles and the templates without restarting.
+func (b *bot) Reload() error {
+	config, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	access, err := b.loadAccess(config)
+	if err != nil {
+		return err
+	}
+
+	// the current templates are kept if the new ones are incorrect
+	templates, err := LoadTemplates(config.TemplatesDir)
+	if err != nil {
+		return err
+	}
+
+	location, err := loadLocation(config.Timezone)
+	if err != nil {
+		return err
+	}
+
+	clients, settings, err := b.buildClients(config.ClientConfigs())
+	if err != nil {
+		return err
+	}
+
+	b.setClients(clients, settings)
+
+	b.mu.Lock()
+	b.access = access
+	b.templates = templates
+	b.lang = config.Language
+	b.location = location
+	b.mu.Unlock()
+
+	log.Info().Msgf("[config] reloaded, %d clients", len(clients))
+	return nil
+}
+
+// buildClients returns the clients by the configs, existing clients with the same token are reused
+// to keep the rate limiter and the reports.
+func (b *bot) buildClients(configs []ClientConfig) ([]Client, map[uint32]*clientSettings, error) {
+	existing := map[string]Client{}
+
+	b.mu.RLock()
+	for _, client := range b.clients {
+		if s, ok := b.settings[client.GetID()]; ok {
+			existing[s.config.Token] = client
+		}
+	}
+	b.mu.RUnlock()
+
+	clients := make([]Client, 0, len(configs))
+	settings := make(map[uint32]*clientSettings, len(configs))
+	for i, config := range configs {
+		clientSettings, err := newClientSettings(config)
+		if err != nil {
+			return nil, nil, err
+		}
+		clientSettings.index = i
+
+		client, ok := existing[config.Token]
+		if !ok || client.GetAlias() != config.Alias || client.GetDefaultAccount() != config.DefaultAccount {
+			client = NewClient(config)
+			client.OnInfo(func(info ClientInfo) {
+				b.publishBalances(client, info)
+			})
+
+			if err := client.Init(); err != nil {
+				return nil, nil, err
+			}
 		}
 
 		clients = append(clients, client)
+		settings[client.GetID()] = clientSettings
+	}
+
+	return clients, settings, nil
+}
+
+// newClientSettings compiles and validates the template overrides of the client
+func newClientSettings(config ClientConfig) (*clientSettings, error) {
+	settings := &clientSettings{config: config}
+
+	if config.Templates.Statement != "" {
+		tmpl, err := parseTemplate(statementTemplateName, config.Templates.Statement)
+		if err != nil {
+			return nil, fmt.Errorf("client %s, statement template: %w", config.Alias, err)
+		}
+		settings.statementTmpl = tmpl
+	}
+
+	if config.Templates.Balance != "" {
+		tmpl, err := parseTemplate(balanceTemplateName, config.Templates.Balance)
+		if err != nil {
+			return nil, fmt.Errorf("client %s, balance template: %w", config.Alias, err)
+		}
+		settings.balanceTmpl = tmpl
+	}
+
+	return settings, nil
+}
+
+// setClients replaces the clients from the configuration, the clients of the users are kept
+func (b *bot) setClients(clients []Client, settings map[uint32]*clientSettings) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, client := range b.userClients {
+		if s, ok := b.settings[client.GetID()]; ok {
+			settings[client.GetID()] = s
+		}
 	}
 
 	b.clients = clients
+	b.settings = settings
+}
 
-	return nil
+// getClients returns the current clients, the clients of the users are after the configured ones
+func (b *bot) getClients() []Client {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if len(b.userClients) == 0 {
+		return b.clients
+	}
+
+	return append(append([]Client{}, b.clients...), b.userClients...)
 }
 
-// TelegramStart starts getting updates from telegram.
-func (b *bot) TelegramStart(token string) {
-	botAPI, err := tgbotapi.NewBotAPI(token)
-	if err != nil {
-		log.Panic().Err(err).Msg("[telegram] create bot")
+// getClientSettings returns the settings of the client
+func (b *bot) getClientSettings(client Client) clientSettings {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if settings, ok := b.settings[client.GetID()]; ok {
+		return *settings
 	}
 
-	b.BotAPI = botAPI
+	return clientSettings{}
+}
+
+// getTemplate returns the template by the name for the chat, the overrides of the chat and the client
+// take precedence over the default one
+func (b *bot) getTemplate(name string, client Client, chatID int64) *template.Template {
+	b.mu.RLock()
+	templates := b.templates
+	b.mu.RUnlock()
+
+	var configured *template.Template
+	if client != nil {
+		settings := b.getClientSettings(client)
+		switch name {
+		case statementTemplateName:
+			configured = settings.statementTmpl
+		case balanceTemplateName:
+			configured = settings.balanceTmpl
+		}
+	}
 
-	log.Info().Msgf("Authorized on account %s", b.BotAPI.Self.UserName)
+	return templates.get(name, client, chatID, configured)
+}
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+// TelegramStart starts getting updates from telegram until the context is done.
+// The updates are received by the webhook if it is configured, otherwise by the long polling.
+func (b *bot) TelegramStart(ctx context.Context, token string) error {
+	// the restarts reuse the bot
+	botAPI := b.getBotAPI()
+	if botAPI == nil {
+		var err error
+		if botAPI, err = tgbotapi.NewBotAPI(token); err != nil {
+			log.Error().Err(err).Msg("[telegram] create bot")
+			return err
+		}
 
-	updates, err := b.BotAPI.GetUpdatesChan(u)
-	if err != nil {
-		log.Panic().Err(err).Msg("[telegram] get updates chan")
+		b.botAPIMu.Lock()
+		b.botAPI = botAPI
+		b.botAPIMu.Unlock()
+
+		log.Info().Msgf("Authorized on account %s", botAPI.Self.UserName)
 	}
 
-	for update := range updates {
-		if update.CallbackQuery == nil && update.Message == nil {
-			log.Warn().Msg("[telegram] received incorrect updates")
-			continue
+	// the menu is optional, the commands work without it
+	if err := b.registerCommands(); err != nil {
+		log.Error().Err(err).Msg("[telegram] register commands")
+	}
+
+	var updates tgbotapi.UpdatesChannel
+	if b.telegramWebhookURL != "" {
+		if err := b.setTelegramWebhook(); err != nil {
+			log.Error().Err(err).Msg("[telegram] set webhook")
+			return err
 		}
 
-		var fromID int
-		var chatID int64
-		if update.Message != nil {
-			fromID = update.Message.From.ID
-			chatID = update.Message.Chat.ID
-		} else {
-			fromID = update.CallbackQuery.Message.ReplyToMessage.From.ID
-			chatID = update.CallbackQuery.Message.ReplyToMessage.Chat.ID
+		updates = b.telegramUpdates
+	} else {
+		// the long polling does not work while the webhook is set
+		if _, err := botAPI.RemoveWebhook(); err != nil {
+			log.Error().Err(err).Msg("[telegram] remove webhook")
+			return err
 		}
 
-		log.Debug().Msgf("[telegram] received a message from %d in chat %d", fromID, chatID)
+		u := tgbotapi.NewUpdate(0)
+		u.Timeout = 60
 
-		if !(b.isAdmin(fromID) || b.isChat(chatID)) {
-			if update.CallbackQuery != nil {
-				_, err = b.BotAPI.AnswerCallbackQuery(tgbotapi.CallbackConfig{
-					CallbackQueryID: update.CallbackQuery.ID,
-					Text:            "Access denied",
-				})
-				if err != nil {
-					log.Error().Err(err).Msg("[telegram] access denied, callback answer error")
-				}
+		var err error
+		updates, err = botAPI.GetUpdatesChan(u)
+		if err != nil {
+			log.Error().Err(err).Msg("[telegram] get updates chan")
+			return err
+		}
+		defer botAPI.StopReceivingUpdates()
+	}
+
+	b.health.Up("telegram")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case update, ok := <-updates:
+			if !ok {
+				return errors.New("updates channel closed")
 			}
 
-			continue
+			b.handleUpdate(update)
 		}
+	}
+}
 
-		if update.Message != nil && strings.HasPrefix(update.Message.Text, "/balance") {
-			if len(b.clients) > 1 {
-				_, err = b.BotAPI.Send(b.sendClientButtons("bc", update))
-				if err != nil {
-					log.Error().Err(err).Msg("[telegram] report send msg error")
-				}
-			} else {
-				err := b.sendBalanceByClient(b.clients[0], update.Message)
-				if err != nil {
-					log.Error().Err(err).Msg("[telegram] balance, send msg error")
-				}
-			}
+// handleUpdate handles the update received from telegram.
+func (b *bot) handleUpdate(update tgbotapi.Update) {
+	if update.CallbackQuery == nil && update.Message == nil {
+		log.Warn().Msg("[telegram] received incorrect updates")
+		return
+	}
 
-		} else if update.Message != nil && strings.HasPrefix(update.Message.Text, "/report") {
-			log.Debug().Msg("[telegram] report")
-
-			if len(b.clients) > 1 {
-				_, err = b.BotAPI.Send(b.sendClientButtons("rc", update))
-				if err != nil {
-					log.Error().Err(err).Msg("[telegram] report send msg error")
-				}
-			} else {
-				tmConfig, err := sendAccountButtonsMessage("ra", b.clients[0], *update.Message)
-				if err != nil {
-					log.Error().Err(err).Msg("[telegram] report send msg error")
-				}
-
-				_, err = b.BotAPI.Send(tmConfig)
-				if err != nil {
-					log.Error().Err(err).Msg("[telegram] report send msg error")
-				}
-			}
-		} else if update.Message != nil && strings.HasPrefix(update.Message.Text, "/get_webhook") {
-
-			r1 := strings.Split(strings.TrimPrefix(update.Message.Text, "/get_webhook"), "_")
-			idx := 0
-			if len(r1) == 1 {
-				idx = 0
-			} else {
-				idx, _ = strconv.Atoi(r1[1])
-			}
+	if update.Message != nil {
+		b.handleMessage(update.Message)
+		return
+	}
+
+	b.handleCallback(update)
+}
+
+// callbackGrant returns the role of the chat of the button, not of the user who sent the command,
+// any member of the group can press the buttons
+func (b *bot) callbackGrant(query *tgbotapi.CallbackQuery) (AccessConfig, bool) {
+	if query.From == nil || query.Message == nil || query.Message.Chat == nil {
+		return AccessConfig{}, false
+	}
+
+	log.Debug().Msgf("[telegram] received a callback from %d in chat %d", query.From.ID, query.Message.Chat.ID)
+
+	return b.getAccess().resolve(query.Message.Chat.ID)
+}
+
+// handleCallback handles the callback query of the inline keyboards
+func (b *bot) handleCallback(update tgbotapi.Update) {
+	var err error
+
+	lang := b.defaultLanguage()
+	if update.CallbackQuery.Message != nil {
+		lang = b.messageLanguage(update.CallbackQuery.Message)
+	}
+
+	callbackQueryData, err := b.parseCallback(update.CallbackQuery.Data)
+	if err != nil || update.CallbackQuery.Message == nil || update.CallbackQuery.Message.ReplyToMessage == nil {
+		log.Debug().Err(err).Msg("[telegram] outdated callback")
+
+		b.answerCallback(update.CallbackQuery, T(lang, "button_outdated"))
+		return
+	}
+
+	access := b.getAccess()
+
+	grant, ok := b.callbackGrant(update.CallbackQuery)
+	if !ok {
+		b.denyAccess(update, false)
+		return
+	}
+
+	if command := callbackCommand(callbackQueryData.Prefix); !access.can(grant, command) {
+		log.Debug().Msgf("[telegram] %s is not allowed to %s", command, grant.Role)
+
+		b.denyAccess(update, true)
+		return
+	}
+
+	// the search results are of all visible clients
+	if callbackQueryData.Prefix == "sr" {
+		b.editSearchPage(update, grant, callbackQueryData, lang)
+		return
+	}
 
-			client, err := b.getClient(idx)
+	client, err := b.getClientByID(callbackQueryData.ClientID)
+	if err != nil {
+		msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, err.Error())
+		b.send(msg)
+		return
+	}
+
+	if !b.canSeeClient(grant, client) || (callbackQueryData.Account != "" && !b.canSeeAccount(grant, client, callbackQueryData.Account)) {
+		b.denyAccess(update, true)
+		return
+	}
+
+	if callbackQueryData.Prefix == "bc" {
+		// balance
+		message, err := b.buildBalanceByClient(client, grant, update.CallbackQuery.Message.Chat.ID, lang)
+		if err != nil {
+			log.Error().Err(err).Msg("[telegram] balance, send msg error")
+			return
+		}
+
+		messageConfig := tgbotapi.NewEditMessageText(
+			update.CallbackQuery.Message.Chat.ID,
+			update.CallbackQuery.Message.MessageID,
+			message,
+		)
+		messageConfig.ParseMode = tgbotapi.ModeHTML
+
+		_, err = b.send(messageConfig)
+		if err != nil {
+			log.Error().Err(err).Msg("[telegram] balance, send msg error")
+		}
+	} else if callbackQueryData.Prefix == "rc" {
+		// report account
+
+		if account := b.getDefaultAccount(client, grant); account != nil {
+			// the default account skips the account selection
+			session, err := b.newCallbackSession(client.GetID(), account.ID, callbackQueryData.Tag)
 			if err != nil {
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, err.Error())
-				b.BotAPI.Send(msg)
-				continue
+				log.Error().Err(err).Msg("[telegram] report callback session")
+				return
 			}
 
-			clientInfo, err := client.GetInfo()
+			message := client.GetReport(account.ID).GetKeyboarButtonConfig(update, session, lang)
+			message.Text = fmt.Sprintf(
+				"%s, %s%s\n%s",
+				client.GetName(),
+				FormatPrice(lang, account.Balance),
+				GetCurrencySymbol(account.CurrencyCode),
+				message.Text,
+			)
+
+			_, err = b.send(message)
 			if err != nil {
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, err.Error())
-				b.BotAPI.Send(msg)
-				continue
+				log.Error().Err(err).Msg("[telegram] report send msg error")
 			}
-
-			var tpl bytes.Buffer
-			err = b.webhookTmpl.Execute(&tpl, clientInfo)
+		} else {
+			mConfig, err := b.sendAccountButtonsEditMessage("ra", client, *update.CallbackQuery.Message, b.accountFilter(client, grant), callbackQueryData.Tag)
 			if err != nil {
-				log.Error().Err(err).Msg("[telegram] get webhook, template execute error")
-				continue
+				log.Error().Err(err).Msg("[telegram] report send msg error")
+				return
 			}
-			message := tpl.String()
 
-			msg := tgbotapi.NewMessage(update.Message.Chat.ID, message)
-			msg.ReplyToMessageID = update.Message.MessageID
-
-			_, err = b.BotAPI.Send(msg)
+			_, err = b.send(mConfig)
 			if err != nil {
-				log.Error().Err(err).Msg("[telegram] get webhook, send msg error")
+				log.Error().Err(err).Msg("[telegram] report send msg error")
 			}
-		} else if update.Message != nil && strings.HasPrefix(update.Message.Text, "/set_webhook") {
+		}
+	} else if callbackQueryData.Prefix == "ra" {
+		account, err := client.GetAccountByID(callbackQueryData.Account)
+		if err != nil {
+			msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, err.Error())
+			b.send(msg)
+			return
+		}
 
-			r0 := strings.TrimPrefix(update.Message.Text, "/set_webhook")
-			r2 := strings.Split(r0, " ")
+		message := client.GetReport(account.ID).GetKeyboarButtonConfig(update, callbackQueryData.Session, lang)
+		message.Text = fmt.Sprintf(
+			"%s, %s%s\n%s",
+			client.GetName(),
+			FormatPrice(lang, account.Balance),
+			GetCurrencySymbol(account.CurrencyCode),
+			message.Text,
+		)
 
-			if len(r2) != 2 {
-				continue
-			}
-
-			r1 := strings.Split(r2[0], "_")
+		_, err = b.send(message)
+		if err != nil {
+			log.Error().Err(err).Msg("[telegram] report send msg error")
+		}
+	} else if contains([]string{"rp", "rr", "rd", "rk", "rs"}, callbackQueryData.Prefix) {
+		// report
+		log.Debug().Msg("[telegram] report grid page")
 
-			idx := 0
-			if len(r1) == 1 {
-				idx = 0
-			} else {
-				idx, _ = strconv.Atoi(r1[1])
-			}
+		account, err := client.GetAccountByID(callbackQueryData.Account)
+		if err != nil {
+			msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, err.Error())
+			b.send(msg)
 
-			if !IsURL(r2[1]) {
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Incorrect url")
-				b.BotAPI.Send(msg)
-				continue
-			}
+			log.Error().Err(err).Msg("[telegram] get account by ID")
+			return
+		}
 
-			client, err := b.getClient(idx)
+		if !client.GetReport(account.ID).IsExistGridData(update) {
+			items, err := client.GetStatement(callbackQueryData.Period, account.ID)
 			if err != nil {
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, err.Error())
-				b.BotAPI.Send(msg)
-				continue
+				msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, err.Error())
+				b.send(msg)
+
+				log.Error().Err(err).Msg("[telegram] report grid page get statements")
+				return
 			}
+			b.annotateItems(items)
 
-			response, err := client.SetWebHook(r2[1])
-			if err != nil {
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, err.Error())
-				b.BotAPI.Send(msg)
-				continue
+			if err := b.saveStatements(client, *account, items); err != nil {
+				log.Error().Err(err).Msg("[telegram] report save statements")
 			}
 
-			message := response.Status
-			if message == "" {
-				message = fmt.Sprintf("error: %s", response.ErrorDescription)
+			// reinit statements data if does not exist
+			client.GetReport(account.ID).SetGridData(update, items)
+		}
+
+		var editMessage tgbotapi.Chattable
+
+		chatID := update.CallbackQuery.Message.Chat.ID
+		view := ReportView{
+			Tmpl: b.getTemplate(reportTemplateName, client, chatID),
+			Lang: lang,
+			Loc:  b.timezone(chatID),
+			Tag:  callbackQueryData.Tag,
+
+			Categorize: b.categorizer(client.GetID()),
+			Session: func(items []string, offset int) (string, error) {
+				return b.saveCallbackSession(callbackSession{
+					ClientID: callbackQueryData.ClientID,
+					Account:  callbackQueryData.Account,
+					Tag:      callbackQueryData.Tag,
+					Items:    items,
+					Offset:   offset,
+				})
+			},
+		}
+
+		if callbackQueryData.Prefix == "rs" {
+			if err := b.chooseCategory(client.GetReport(account.ID), update, callbackQueryData); err != nil {
+				log.Error().Err(err).Msg("[telegram] report choose category")
+				b.answerCallback(update.CallbackQuery, T(lang, "button_outdated"))
+				return
 			}
 
-			msg := tgbotapi.NewMessage(update.Message.Chat.ID, message)
-			msg.ReplyToMessageID = update.Message.MessageID
+			// the detail of the item is shown with the chosen category, the session has the item only
+			callbackQueryData.Page = callbackQueryData.Offset + 1
+		}
 
-			_, err = b.BotAPI.Send(msg)
+		if callbackQueryData.Prefix == "rk" {
+			keyboard, err := b.categoryKeyboard(client.GetReport(account.ID), update, lang, callbackQueryData)
+			if errors.Is(err, errCallbackOutdated) {
+				b.answerCallback(update.CallbackQuery, T(lang, "button_outdated"))
+				return
+			}
 			if err != nil {
-				log.Error().Err(err).Msg("[telegram] set webhook, send msg error")
+				log.Error().Err(err).Msg("[telegram] report category keyboard")
+				b.answerCallback(update.CallbackQuery, T(lang, "error"))
+				return
 			}
-		} else if update.Message != nil {
-			log.Warn().Msg("[telegram] the messuge unsupport")
-		} else if update.CallbackQuery != nil {
 
-			callbackQueryData := callbackQueryDataParser(update.CallbackQuery.Data)
+			editMessage = tgbotapi.NewEditMessageReplyMarkup(chatID, update.CallbackQuery.Message.MessageID, keyboard)
 
-			client, err := b.getClientByID(callbackQueryData.ClientID)
+		} else if callbackQueryData.Prefix == "rd" || callbackQueryData.Prefix == "rs" {
+			detailView := view
+			detailView.Tmpl = b.getTemplate(detailTemplateName, client, chatID)
+			_editMessage, err := client.GetReport(account.ID).GetItemDetail(update, callbackQueryData, detailView, client.GetName(), *account)
 			if err != nil {
-				msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, err.Error())
-				b.BotAPI.Send(msg)
-				continue
+				b.answerCallback(update.CallbackQuery, T(lang, "button_outdated"))
+				return
 			}
+			editMessage = _editMessage
+
+		} else if callbackQueryData.Prefix == "rp" {
+			_editMessage := client.GetReport(account.ID).GetReportGrid(update, view)
+			_editMessage.Text = fmt.Sprintf(
+				"<b>%s</b>, <code>%s%s</code>, %s\n%s",
+				html.EscapeString(client.GetName()),
+				FormatPrice(lang, account.Balance),
+				GetCurrencySymbol(account.CurrencyCode),
+				periodLabel(lang, callbackQueryData.Period),
+				_editMessage.Text,
+			)
+			editMessage = _editMessage
 
-			if update.CallbackQuery.Data != "" && update.CallbackQuery.Data[:2] == "bc" {
-				// balance
-				message, err := b.buildBalanceByClient(client)
-				if err != nil {
-					log.Error().Err(err).Msg("[telegram] balance, send msg error")
-					continue
-				}
-
-				messageConfig := tgbotapi.NewEditMessageText(
-					update.CallbackQuery.Message.Chat.ID,
-					update.CallbackQuery.Message.MessageID,
-					message,
-				)
-
-				_, err = b.BotAPI.Send(messageConfig)
-				if err != nil {
-					log.Error().Err(err).Msg("[telegram] balance, send msg error")
-				}
-			} else if update.CallbackQuery.Data != "" && update.CallbackQuery.Data[:2] == "rc" {
-				// report account
-
-				mConfig, err := sendAccountButtonsEditMessage("ra", client, *update.CallbackQuery.Message)
-
-				if err != nil {
-					log.Error().Err(err).Msg("[telegram] report send msg error")
-				}
-
-				_, err = b.BotAPI.Send(mConfig)
-				if err != nil {
-					log.Error().Err(err).Msg("[telegram] report send msg error")
-				}
-			} else if update.CallbackQuery.Data != "" && update.CallbackQuery.Data[:2] == "ra" {
-				account, err := client.GetAccountByID(callbackQueryData.Account)
-				if err != nil {
-					msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, err.Error())
-					b.BotAPI.Send(msg)
-					continue
-				}
-
-				message := client.GetReport(account.ID).GetKeyboarButtonConfig(update, client.GetID())
-				message.Text = fmt.Sprintf(
-					"%s, %s%s\n%s",
-					client.GetName(),
-					NormalizePrice(account.Balance),
-					GetCurrencySymbol(account.CurrencyCode),
-					message.Text,
-				)
-
-				_, err = b.BotAPI.Send(message)
-				if err != nil {
-					log.Error().Err(err).Msg("[telegram] report send msg error")
-				}
-			} else if update.CallbackQuery.Data != "" && (update.CallbackQuery.Data[:2] == "rp" || update.CallbackQuery.Data[:2] == "rr") {
-				// report
-				log.Debug().Msg("[telegram] report grid page")
-
-				account, err := client.GetAccountByID(callbackQueryData.Account)
-				if err != nil {
-					msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, err.Error())
-					b.BotAPI.Send(msg)
-
-					log.Error().Err(err).Msg("[telegram] get account by ID")
-					continue
-				}
-
-				if !client.GetReport(account.ID).IsExistGridData(update) {
-					items, err := client.GetStatement(strings.ReplaceAll(callbackQueryData.Period, "_", " "), account.ID)
-					if err != nil {
-						msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, err.Error())
-						b.BotAPI.Send(msg)
-
-						log.Error().Err(err).Msg("[telegram] report grid page get statements")
-						continue
-					}
-
-					// reinit statements data if does not exist
-					client.GetReport(account.ID).SetGridData(update, items)
-				}
-
-				var editMessage tgbotapi.Chattable
-
-				if update.CallbackQuery.Data[:2] == "rp" {
-					_editMessage := client.GetReport(account.ID).GetReportGrid(update, client.GetID())
-					_editMessage.Text = fmt.Sprintf(
-						"%s, %s%s, %s\n%s",
-						client.GetName(),
-						NormalizePrice(account.Balance),
-						GetCurrencySymbol(account.CurrencyCode),
-						strings.ReplaceAll(callbackQueryData.Period, "_", " "),
-						_editMessage.Text,
-					)
-					editMessage = _editMessage
-
-				} else {
-					_editMessage, err := client.GetReport(account.ID).GetUpdatedReportGrid(update)
-					if err != nil {
-						_, err = b.BotAPI.AnswerCallbackQuery(tgbotapi.CallbackConfig{
-							CallbackQueryID: update.CallbackQuery.ID,
-							Text:            "Error :(",
-						})
-						if err != nil {
-							log.Error().Err(err).Msg("[telegram] report grid send callback answer on update error")
-						}
-					}
-					_editMessage.Text = fmt.Sprintf(
-						"%s, %s%s, %s\n%s",
-						client.GetName(),
-						NormalizePrice(account.Balance),
-						GetCurrencySymbol(account.CurrencyCode),
-						strings.ReplaceAll(callbackQueryData.Period, "_", " "),
-						_editMessage.Text,
-					)
-					editMessage = _editMessage
-				}
-
-				_, err = b.BotAPI.Send(editMessage)
-				if err != nil {
-					log.Error().Err(err).Msg("[telegram] report grid send error")
-				}
-			} else {
-				log.Warn().Msg("[telegram] the messege unsupport")
+		} else {
+			_editMessage, err := client.GetReport(account.ID).GetUpdatedReportGrid(update, view)
+			if errors.Is(err, errCallbackOutdated) {
+				b.answerCallback(update.CallbackQuery, T(lang, "button_outdated"))
+				return
 			}
-
-			_, err = b.BotAPI.AnswerCallbackQuery(tgbotapi.CallbackConfig{
-				CallbackQueryID: update.CallbackQuery.ID,
-			})
 			if err != nil {
-				log.Error().Err(err).Msg("[telegram] report grid send callback answer error")
+				b.answerCallback(update.CallbackQuery, T(lang, "error"))
+				return
 			}
+			_editMessage.Text = fmt.Sprintf(
+				"<b>%s</b>, <code>%s%s</code>, %s\n%s",
+				html.EscapeString(client.GetName()),
+				FormatPrice(lang, account.Balance),
+				GetCurrencySymbol(account.CurrencyCode),
+				periodLabel(lang, callbackQueryData.Period),
+				_editMessage.Text,
+			)
+			editMessage = _editMessage
+		}
+
+		_, err = b.send(editMessage)
+		if err != nil {
+			log.Error().Err(err).Msg("[telegram] report grid send error")
 		}
+	} else {
+		log.Warn().Msg("[telegram] the messege unsupport")
 	}
+
+	b.answerCallback(update.CallbackQuery, "")
 }
 
-// TelegramStart starts web server for getting webhooks from the monobank.
-// It run a http handle and a received StatementItemData data sent to the channel for processing.
-func (b *bot) WebhookStart() {
-	http.HandleFunc("/web_hook", func(w http.ResponseWriter, r *http.Request) {
-		body, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			fmt.Fprintf(w, "Not Ok!")
+// WebhookStart starts web server for getting webhooks from the monobank until the context is done.
+// It run a http handle and a received StatementItemData data sent to the queue for processing.
+func (b *bot) WebhookStart(ctx context.Context) error {
+	server, err := newHTTPServer(b.httpConfig, logRequests(b.routes(), b.trustedProxies, b.webhookSecret))
+	if err != nil {
+		log.Error().Err(err).Msg("[webhook] server")
+		return err
+	}
 
-			log.Error().Err(err).Msg("[webhook] read")
-			return
-		}
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		log.Error().Err(err).Msg("[webhook] listen")
+		return err
+	}
 
-		log.Debug().Msgf("[webhook] body %s", string(body))
+	shutdownErr := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
 
-		var statementItemData StatementItemData
-		if err := json.Unmarshal(body, &statementItemData); err != nil {
-			fmt.Fprintf(w, "Not Ok!")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
 
-			log.Error().Err(err).Msg("[webhook] unmarshal")
-			return
-		}
+		shutdownErr <- server.Shutdown(shutdownCtx)
+	}()
 
-		b.ch <- statementItemData
+	b.health.Up("webhook")
 
-		fmt.Fprintf(w, "Ok!")
+	log.Info().Msgf("[webhook] listen on %s, tls: %t", listener.Addr(), server.TLSConfig != nil)
+
+	err = serve(server, listener)
+	if err != http.ErrServerClosed {
+		log.Error().Err(err).Msg("[webhook] serve")
+		return err
+	}
+
+	return <-shutdownErr
+}
+
+// routes returns handlers of the http server
+func (b *bot) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	if b.metricsEnabled {
+		mux.Handle("/metrics", promhttp.Handler())
+	}
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealthReport(w, b.health.Liveness(b.clientStatuses()))
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		b.checkStorage()
+		writeHealthReport(w, b.health.Readiness(b.clientStatuses()))
 	})
 
-	err := http.ListenAndServe(":8080", nil)
+	mux.HandleFunc(b.webhookPath(), b.handleWebhook)
+
+	if b.telegramWebhookURL != "" {
+		mux.HandleFunc(b.telegramWebhookPath(), b.handleTelegramWebhook)
+	}
+
+	return mux
+}
+
+// webhookPath returns a path of the monobank webhook, the secret is a part of the path if it is configured
+func (b *bot) webhookPath() string {
+	if b.webhookSecret == "" {
+		return "/web_hook"
+	}
+
+	return "/web_hook/" + b.webhookSecret
+}
+
+// handleWebhook handles requests of the monobank webhook, a received StatementItemData data is pushed to the queue.
+func (b *bot) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// monobank validates the url before accepting it
+		fmt.Fprintf(w, "Ok!")
+		return
+	case http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	webhooksReceived.Inc()
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, webhookMaxBodySize))
 	if err != nil {
-		log.Panic().Err(err).Msg("[webhook] serve")
+		webhooksFailed.WithLabelValues("read").Inc()
+		http.Error(w, "Not Ok!", http.StatusRequestEntityTooLarge)
+
+		log.Error().Err(err).Msg("[webhook] read")
+		return
 	}
+
+	var statementItemData StatementItemData
+	if err := json.Unmarshal(body, &statementItemData); err != nil || statementItemData.Type != "StatementItem" {
+		webhooksFailed.WithLabelValues("unmarshal").Inc()
+		http.Error(w, "Not Ok!", http.StatusBadRequest)
+
+		log.Error().Err(err).Msgf("[webhook] unmarshal, type %q", statementItemData.Type)
+		return
+	}
+
+	// the body has the personal data of the statement, only its type and account are logged
+	log.Debug().Msgf("[webhook] received %s of the account %s", statementItemData.Type, statementItemData.Data.Account)
+
+	// strangers are not able to inject transactions to the accounts which are not configured
+	if _, err := b.getClientByAccountID(statementItemData.Data.Account); err != nil {
+		webhooksFailed.WithLabelValues("account").Inc()
+		http.Error(w, "Not Ok!", http.StatusForbidden)
+
+		log.Warn().Err(err).Msg("[webhook] unknown account")
+		return
+	}
+
+	added, err := b.queue.Push(statementItemData)
+	if err != nil {
+		webhooksFailed.WithLabelValues("queue").Inc()
+
+		// monobank retries the webhook on error
+		http.Error(w, "Not Ok!", http.StatusInternalServerError)
+
+		log.Error().Err(err).Msg("[webhook] queue push")
+		return
+	}
+
+	if !added {
+		log.Debug().Msgf("[webhook] statement %s is already received", statementItemData.Data.StatementItem.ID)
+	}
+
+	// wake up the processing, it is not blocked if the processing is busy
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+
+	fmt.Fprintf(w, "Ok!")
 }
 
-// ProcessingStart starts processing data that received from chennal.
-func (b *bot) ProcessingStart() {
+// ProcessingStart starts processing data that received from the queue until the context is done,
+// the items which are due are processed before returning, the rest stays in the queue.
+func (b *bot) ProcessingStart(ctx context.Context) error {
+	b.health.Up("processing")
 
-	sendTo := func(chatIds, message string) error {
-		ids := strings.Split(strings.Trim(chatIds, " "), ",")
-		for _, id := range ids {
-			chatID, err := strconv.ParseInt(id, 10, 64)
-			if err != nil {
-				return err
-			}
+	ticker := time.NewTicker(queueMinBackoff)
+	defer ticker.Stop()
 
-			_, err = b.BotAPI.Send(tgbotapi.NewMessage(chatID, message))
-			if err != nil {
-				return err
+	var prunedAt time.Time
+	for {
+		if err := b.processQueue(); err != nil {
+			return err
+		}
+
+		if time.Since(prunedAt) > time.Hour {
+			if err := b.queue.Prune(time.Now()); err != nil {
+				log.Error().Err(err).Msg("[processing] queue prune")
+			}
+			if err := b.pruneInvites(time.Now()); err != nil {
+				log.Error().Err(err).Msg("[processing] invites prune")
+			}
+			if err := b.pruneMessageRefs(time.Now()); err != nil {
+				log.Error().Err(err).Msg("[processing] messages prune")
+			}
+			if err := b.pruneCallbacks(time.Now()); err != nil {
+				log.Error().Err(err).Msg("[processing] callbacks prune")
 			}
+			prunedAt = time.Now()
 		}
 
-		return nil
+		select {
+		case <-ctx.Done():
+			return b.processQueue()
+		case <-b.notify:
+		case <-ticker.C:
+		}
 	}
+}
 
-	for {
-		statementItemData := <-b.ch
+// processQueue processes the items of the queue which are due, failed items are retried with backoff.
+func (b *bot) processQueue() error {
+	items, err := b.queue.Due(time.Now())
+	if err != nil {
+		log.Error().Err(err).Msg("[processing] queue due")
+		return err
+	}
 
-		client, err := b.getClientByAccountID(statementItemData.Data.Account)
-		if err != nil {
-			log.Error().Err(err).Msg("[processing] get client by account")
+	for _, item := range items {
+		err := b.processStatementItem(&item)
+		if err == nil {
+			if err := b.queue.Done(item); err != nil {
+				log.Error().Err(err).Msg("[processing] queue done")
+			}
+
+			b.health.Up("processing")
 			continue
 		}
 
-		account, err := client.GetAccountByID(statementItemData.Data.Account)
-		if err != nil {
-			log.Error().Err(err).Msg("[processing] get account by id")
-			continue
+		retried, qerr := b.queue.Retry(item, err)
+		if qerr != nil {
+			log.Error().Err(qerr).Msg("[processing] queue retry")
 		}
 
-		client.ResetReport(statementItemData.Data.Account)
+		if retried {
+			log.Warn().Err(err).Msgf("[processing] statement %s failed, attempt %d", item.Data.Data.StatementItem.ID, item.Attempts+1)
+		} else {
+			log.Error().Err(err).Msgf("[processing] statement %s dropped after %d attempts", item.Data.Data.StatementItem.ID, item.Attempts+1)
+		}
+	}
+
+	return nil
+}
 
-		var tpl bytes.Buffer
-		err = b.statementTmpl.Execute(&tpl, struct {
-			Name          string
-			StatementItem StatementItem
-			Account       Account
-		}{
-			Name:          client.GetName(),
-			StatementItem: statementItemData.Data.StatementItem,
-			Account:       *account,
+// Run starts all subsystems supervised and waits until the context is done and the subsystems are stopped.
+func (b *bot) Run(ctx context.Context, token string) {
+	// the processing is stopped after the webhook server to drain the channel
+	processingCtx, stopProcessing := context.WithCancel(context.Background())
+	defer stopProcessing()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		supervise(ctx, b.health, "telegram", func(ctx context.Context) error {
+			return b.TelegramStart(ctx, token)
 		})
-		if err != nil {
-			log.Error().Err(err).Msg("[processing] template execute error")
+	}()
+
+	go func() {
+		defer wg.Done()
+		supervise(processingCtx, b.health, "processing", b.ProcessingStart)
+	}()
+
+	if b.publicURL != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			supervise(ctx, b.health, "webhook_check", b.WebhookCheckStart)
+		}()
+	}
+
+	supervise(ctx, b.health, "webhook", b.WebhookStart)
+
+	stopProcessing()
+	wg.Wait()
+}
+
+// Close releases resources of the bot
+func (b *bot) Close() {
+	// the downloaded copies are saved to the storage
+	b.downloads.Wait()
+
+	if b.publisher != nil {
+		b.publisher.Close()
+	}
+
+	if err := b.storage.Close(); err != nil {
+		log.Error().Err(err).Msg("[storage] close")
+	}
+}
+
+// processStatementItem sends the statement item received by the webhook to the chats and admins,
+// an error is returned only if the sending should be retried.
+func (b *bot) processStatementItem(item *QueueItem) error {
+	statementItemData := item.Data
+
+	client, err := b.getClientByAccountID(statementItemData.Data.Account)
+	if err != nil {
+		log.Error().Err(err).Msg("[processing] get client by account")
+		return nil
+	}
+
+	account, err := client.GetAccountByID(statementItemData.Data.Account)
+	if err != nil {
+		log.Error().Err(err).Msg("[processing] get account by id")
+		return nil
+	}
+
+	// the rules set the category of the new item
+	statementItem := statementItemData.Data.StatementItem
+	b.categorizer(client.GetID())(&statementItem)
+
+	// only the first attempt, the retries are just for telegram
+	if item.Attempts == 0 {
+		client.ResetReport(statementItemData.Data.Account)
+
+		if err := b.saveStatements(client, *account, []StatementItem{statementItem}); err != nil {
+			log.Error().Err(err).Msg("[processing] save statement")
+		}
+
+		b.publishStatementItem(client, *account, statementItem)
+	}
+
+	data := StatementMessage{
+		Name:          client.GetName(),
+		StatementItem: statementItem,
+		Account:       *account,
+	}
+
+	// the message is rendered once for every template and language of the recipients
+	type messageKey struct {
+		tmpl *template.Template
+		lang Lang
+	}
+	messages := map[messageKey]string{}
+
+	// to chats and admins
+	for _, chatID := range b.recipients(client, account.ID) {
+		if item.IsDelivered(chatID) {
 			continue
 		}
-		message := tpl.String()
 
-		// to chat
-		err = sendTo(b.telegramChats, message)
+		key := messageKey{b.getTemplate(statementTemplateName, client, chatID), b.language(chatID)}
+		if _, ok := messages[key]; !ok {
+			message, err := executeTemplate(key.tmpl, key.lang, b.timezone(chatID), data)
+			if err != nil {
+				log.Error().Err(err).Msg("[processing] template execute error")
+				return nil
+			}
+			messages[key] = message
+		}
+
+		sent, err := b.send(htmlMessage(chatID, messages[key]))
 		if err != nil {
-			log.Error().Err(err).Msg("[processing] send to chat")
-			continue
+			return fmt.Errorf("send to %d: %w", chatID, err)
+		}
+
+		// the replies to the notification annotate the statement item
+		ref := messageRef{ClientID: client.GetID(), Account: account.ID, StatementID: data.StatementItem.ID, Time: data.StatementItem.Time}
+		if err := b.saveMessageRef(sent, ref); err != nil {
+			log.Error().Err(err).Msg("[processing] save message")
+		}
+
+		item.Delivered = append(item.Delivered, chatID)
+	}
+
+	return nil
+}
+
+// recipients returns ids of the chats to send notifications of the account,
+// the users and chats which can see the account are used if the client does not have own chats
+func (b *bot) recipients(client Client, accountID string) []int64 {
+	settings := b.getClientSettings(client)
+	if settings.owner != 0 {
+		return append([]int64{settings.owner}, settings.shared...)
+	}
+
+	if len(settings.config.Chats) > 0 {
+		return settings.config.Chats
+	}
+
+	return b.getAccess().recipients(client, settings.index, accountID)
+}
+
+// admins returns ids of the owners
+func (b *bot) admins() []int64 {
+	return b.getAccess().owners()
+}
+
+// getBotAPI returns the telegram bot, it is nil until telegram is started
+func (b *bot) getBotAPI() *tgbotapi.BotAPI {
+	b.botAPIMu.RLock()
+	defer b.botAPIMu.RUnlock()
+
+	return b.botAPI
+}
+
+// getAccess returns the current roles
+func (b *bot) getAccess() *access {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.access
+}
+
+// visibleClients returns the clients visible to the access
+func (b *bot) visibleClients(grant AccessConfig) []Client {
+	clients := []Client{}
+	for _, client := range b.getClients() {
+		if b.canSeeClient(grant, client) {
+			clients = append(clients, client)
 		}
+	}
+
+	return clients
+}
+
+// canSeeClient checks the client is visible to the access, the clients of the users are visible
+// only in the private chat of the user and the shared chats
+func (b *bot) canSeeClient(grant AccessConfig, client Client) bool {
+	settings := b.getClientSettings(client)
+	if settings.owner != 0 {
+		return grant.Chat == settings.owner || contains(settings.shared, grant.Chat)
+	}
+
+	return grant.canSeeClient(client, settings.index)
+}
+
+// canSeeAccount checks the account of the client is visible to the access
+func (b *bot) canSeeAccount(grant AccessConfig, client Client, accountID string) bool {
+	settings := b.getClientSettings(client)
+	if settings.owner != 0 {
+		return b.canSeeClient(grant, client)
+	}
+
+	return grant.canSeeAccount(client, settings.index, accountID)
+}
+
+// accountFilter returns a filter of the accounts of the client visible to the access
+func (b *bot) accountFilter(client Client, grant AccessConfig) func(ClientInfo) ClientInfo {
+	return func(info ClientInfo) ClientInfo {
+		accounts := []Account{}
+		for _, account := range info.Accounts {
+			if b.canSeeAccount(grant, client, account.ID) {
+				accounts = append(accounts, account)
+			}
+		}
+
+		info.Accounts = accounts
+		return info
+	}
+}
+
+// denyAccess answers the callback, the message is answered only to the known users and chats
+func (b *bot) denyAccess(update tgbotapi.Update, known bool) {
+	if update.CallbackQuery != nil {
+		lang := b.defaultLanguage()
+		if update.CallbackQuery.Message != nil {
+			lang = b.messageLanguage(update.CallbackQuery.Message)
+		}
+
+		b.answerCallback(update.CallbackQuery, T(lang, "access_denied"))
+		return
+	}
+
+	if known {
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, T(b.messageLanguage(update.Message), "access_denied"))
+		msg.ReplyToMessageID = update.Message.MessageID
+
+		if _, err := b.send(msg); err != nil {
+			log.Error().Err(err).Msg("[telegram] access denied, send msg error")
+		}
+	}
+}
+
+// callbackCommand returns the command of the callback prefix to check the access
+func callbackCommand(prefix string) string {
+	if prefix == "bc" {
+		return "balance"
+	}
+
+	if prefix == "sr" {
+		return "search"
+	}
+
+	// the categories of the items are changed by the same users as the rules
+	if prefix == "rk" || prefix == "rs" {
+		return "rule"
+	}
+
+	return "report"
+}
 
-		// to admin
-		err = sendTo(b.telegramAdmins, message)
+// parseIds parses the comma separated ids, incorrect ones are skipped
+func parseIds(stringIds string) []int64 {
+	ids := []int64{}
+	for _, id := range strings.Split(stringIds, ",") {
+		chatID, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64)
 		if err != nil {
-			log.Error().Err(err).Msg("[processing] send to admin")
 			continue
 		}
+
+		ids = append(ids, chatID)
+	}
+
+	return ids
+}
+
+// publishBalances publishes balances of all accounts of the client
+func (b *bot) publishBalances(client Client, info ClientInfo) {
+	// the data of the users is not published
+	if b.getClientSettings(client).owner != 0 {
+		return
+	}
+
+	for _, account := range info.Accounts {
+		b.publishBalance(client, account)
+	}
+}
+
+// publishBalance publishes the balance of the account to the MQTT and the metrics
+func (b *bot) publishBalance(client Client, account Account) {
+	if b.metricsBalances {
+		setAccountBalance(client, account)
+	}
+
+	if b.publisher == nil {
+		return
+	}
+
+	if err := b.publisher.PublishBalance(client, account); err != nil {
+		log.Error().Err(err).Msg("[mqtt] publish balance")
+	}
+}
+
+// publishStatementItem publishes the transaction and the balance after it
+func (b *bot) publishStatementItem(client Client, account Account, item StatementItem) {
+	if b.getClientSettings(client).owner != 0 {
+		return
+	}
+
+	if b.publisher != nil {
+		if err := b.publisher.PublishStatementItem(client, account, item); err != nil {
+			log.Error().Err(err).Msg("[mqtt] publish statement item")
+		}
+	}
+
+	account.Balance = item.Balance
+	b.publishBalance(client, account)
+}
+
+// send sends the message to telegram and counts it
+func (b *bot) send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	botAPI := b.getBotAPI()
+	if botAPI == nil {
+		telegramSendFailures.Inc()
+		return tgbotapi.Message{}, errors.New("telegram is not ready")
+	}
+
+	message, err := botAPI.Send(c)
+
+	// the message is delivered without the formatting if telegram rejects the markup
+	if isMarkupError(err) {
+		if fallback, ok := plainTextFallback(c); ok {
+			log.Warn().Err(err).Msg("[telegram] send, the markup is rejected, sending the plain text")
+			message, err = botAPI.Send(fallback)
+		}
 	}
+
+	if err != nil {
+		telegramSendFailures.Inc()
+		return message, err
+	}
+
+	telegramSends.Inc()
+	return message, nil
 }
 
-func (b *bot) sendClientButtons(prefix string, update tgbotapi.Update) tgbotapi.MessageConfig {
+func (b *bot) sendClientButtons(prefix string, clients []Client, message *tgbotapi.Message, tag string) (tgbotapi.MessageConfig, error) {
 	buttons := []tgbotapi.InlineKeyboardButton{}
 
-	for _, client := range b.clients {
-		callbackData := callbackQueryDataBuilder(prefix, pageData{
-			Page:     0,
-			Period:   "",
-			ChatID:   update.Message.Chat.ID,
-			FromID:   update.Message.From.ID,
-			ClientID: uint32(client.GetID()),
-		})
+	for _, client := range clients {
+		session, err := b.newCallbackSession(client.GetID(), "", tag)
+		if err != nil {
+			return tgbotapi.MessageConfig{}, err
+		}
+
+		callbackData := callbackQueryDataBuilder(prefix, pageData{Session: session})
 
 		buttons = append(buttons, tgbotapi.InlineKeyboardButton{
 			Text:         client.GetName(),
@@ -544,43 +1308,78 @@ func (b *bot) sendClientButtons(prefix string, update tgbotapi.Update) tgbotapi.
 	inlineKeyboardMarkup := tgbotapi.NewInlineKeyboardMarkup(buttons)
 
 	messageConfig := tgbotapi.MessageConfig{}
-	messageConfig.Text = "Виберіть клієнта:"
-	messageConfig.ChatID = update.Message.Chat.ID
-	messageConfig.ReplyToMessageID = update.Message.MessageID
+	messageConfig.Text = T(b.messageLanguage(message), "choose_client")
+	messageConfig.ChatID = message.Chat.ID
+	messageConfig.ReplyToMessageID = message.MessageID
 	messageConfig.ReplyMarkup = inlineKeyboardMarkup
 
-	return messageConfig
+	return messageConfig, nil
 }
 
-func (b *bot) getClient(index int) (Client, error) {
-	if len(b.clients) > index {
-		return b.clients[index], nil
+// getClientByRef returns the client visible to the access by the index or the alias,
+// the first client is returned for the empty ref
+func (b *bot) getClientByRef(ref string, grant AccessConfig) (Client, error) {
+	index, err := strconv.Atoi(ref)
+	if ref == "" {
+		index, err = 0, nil
+	}
+
+	for i, client := range b.getClients() {
+		if (err == nil && i == index) || (err != nil && client.GetAlias() == ref) {
+			if !b.canSeeClient(grant, client) {
+				break
+			}
+
+			return client, nil
+		}
 	}
 
 	return nil, errors.New("Client does not found")
 }
 
-func (b bot) isAdmin(userID int) bool {
-	return b.checkIds(b.telegramAdmins, int64(userID))
+// getDefaultAccount returns the configured default account of the client if it is visible, or nil
+func (b *bot) getDefaultAccount(client Client, grant AccessConfig) *Account {
+	if client.GetDefaultAccount() == "" {
+		return nil
+	}
+
+	if !b.canSeeAccount(grant, client, client.GetDefaultAccount()) {
+		return nil
+	}
+
+	account, err := client.GetAccountByID(client.GetDefaultAccount())
+	if err != nil {
+		log.Warn().Err(err).Msgf("[telegram] default account of %s", client.GetName())
+		return nil
+	}
+
+	return account
 }
 
-func (b bot) isChat(chatID int64) bool {
-	return b.checkIds(b.telegramChats, chatID)
+// checkStorage updates the status of the storage by a read
+func (b *bot) checkStorage() {
+	if _, err := b.storage.Get(callbacksBucket, "", new(callbackSession)); err != nil {
+		b.health.Down("storage", err)
+		return
+	}
+
+	b.health.Up("storage")
 }
 
-func (b bot) checkIds(stringIds string, id int64) bool {
-	ids := strings.Split(strings.Trim(stringIds, " "), ",")
-	for _, _id := range ids {
-		if reflect.DeepEqual([]byte(_id), []byte(strconv.FormatInt(id, 10))) {
-			return true
-		}
+// clientStatuses returns statuses of the last monobank api calls of the clients
+func (b *bot) clientStatuses() map[string]ComponentStatus {
+	clients := b.getClients()
+
+	statuses := make(map[string]ComponentStatus, len(clients))
+	for _, client := range clients {
+		statuses[fmt.Sprintf("client/%d", client.GetID())] = client.GetStatus()
 	}
 
-	return false
+	return statuses
 }
 
-func (b bot) getClientByID(id uint32) (Client, error) {
-	for _, client := range b.clients {
+func (b *bot) getClientByID(id uint32) (Client, error) {
+	for _, client := range b.getClients() {
 		if client.GetID() == id {
 			return client, nil
 		}
@@ -589,54 +1388,54 @@ func (b bot) getClientByID(id uint32) (Client, error) {
 	return nil, errors.New("client does not found")
 }
 
-func (b bot) getClientByAccountID(id string) (Client, error) {
-	for _, client := range b.clients {
-		info, _ := client.GetInfo()
-		for _, account := range info.Accounts {
-			if account.ID == id {
-				return client, nil
-			}
+// getClientByAccountID returns the client of the account by the cached information, it is used by the webhooks
+// and does not request the monobank api
+func (b *bot) getClientByAccountID(id string) (Client, error) {
+	for _, client := range b.getClients() {
+		if _, err := client.GetAccountByID(id); err == nil {
+			return client, nil
 		}
 	}
 
 	return nil, errors.New("client does not found")
 }
 
-func (b *bot) buildBalanceByClient(client Client) (string, error) {
+func (b *bot) buildBalanceByClient(client Client, grant AccessConfig, chatID int64, lang Lang) (string, error) {
 	clientInfo, err := client.GetInfo()
 	if err != nil {
 		return "", err
 	}
 
-	var tpl bytes.Buffer
-	err = b.balanceTmpl.Execute(&tpl, clientInfo)
-	if err != nil {
-		return "", err
-	}
+	clientInfo = b.accountFilter(client, grant)(clientInfo)
 
-	return tpl.String(), err
+	return executeTemplate(b.getTemplate(balanceTemplateName, client, chatID), lang, b.timezone(chatID), clientInfo)
 }
 
-func (b *bot) sendBalanceByClient(client Client, tgMessage *tgbotapi.Message) error {
-	message, err := b.buildBalanceByClient(client)
+func (b *bot) sendBalanceByClient(client Client, grant AccessConfig, tgMessage *tgbotapi.Message) error {
+	message, err := b.buildBalanceByClient(client, grant, tgMessage.Chat.ID, b.messageLanguage(tgMessage))
 	if err != nil {
 		msg := tgbotapi.NewMessage(tgMessage.Chat.ID, err.Error())
-		_, err = b.BotAPI.Send(msg)
+		_, err = b.send(msg)
 		if err != nil {
 			return err
 		}
 	}
 
-	msg := tgbotapi.NewMessage(tgMessage.Chat.ID, message)
+	msg := htmlMessage(tgMessage.Chat.ID, message)
 	msg.ReplyToMessageID = tgMessage.MessageID
 
-	_, err = b.BotAPI.Send(msg)
+	_, err = b.send(msg)
 	return err
 }
 
-func sendAccountButtonsEditMessage(prefix string, client Client, message tgbotapi.Message) (*tgbotapi.EditMessageTextConfig, error) {
-	messageConfig, inlineKeyboardMarkup, _ := buildAccountButtons[tgbotapi.EditMessageTextConfig](prefix, client, message)
-	messageConfig.Text = fmt.Sprintf("%s\nВиберіть рахунок:", client.GetName())
+func (b *bot) sendAccountButtonsEditMessage(prefix string, client Client, message tgbotapi.Message, filter func(ClientInfo) ClientInfo, tag string) (*tgbotapi.EditMessageTextConfig, error) {
+	lang := b.messageLanguage(&message)
+
+	messageConfig, inlineKeyboardMarkup, err := buildAccountButtons[tgbotapi.EditMessageTextConfig](prefix, client, lang, filter, b.sessionWithTag(tag))
+	if err != nil {
+		return nil, err
+	}
+	messageConfig.Text = fmt.Sprintf("%s\n%s", client.GetName(), T(lang, "choose_account"))
 	messageConfig.ChatID = message.Chat.ID
 	messageConfig.MessageID = message.MessageID
 	messageConfig.ReplyMarkup = inlineKeyboardMarkup
@@ -644,10 +1443,15 @@ func sendAccountButtonsEditMessage(prefix string, client Client, message tgbotap
 	return messageConfig, nil
 }
 
-func sendAccountButtonsMessage(prefix string, client Client, message tgbotapi.Message) (*tgbotapi.MessageConfig, error) {
+func (b *bot) sendAccountButtonsMessage(prefix string, client Client, message tgbotapi.Message, filter func(ClientInfo) ClientInfo, tag string) (*tgbotapi.MessageConfig, error) {
+
+	lang := b.messageLanguage(&message)
 
-	messageConfig, inlineKeyboardMarkup, _ := buildAccountButtons[tgbotapi.MessageConfig](prefix, client, message)
-	messageConfig.Text = fmt.Sprintf("%s\nВиберіть рахунок:", client.GetName())
+	messageConfig, inlineKeyboardMarkup, err := buildAccountButtons[tgbotapi.MessageConfig](prefix, client, lang, filter, b.sessionWithTag(tag))
+	if err != nil {
+		return nil, err
+	}
+	messageConfig.Text = fmt.Sprintf("%s\n%s", client.GetName(), T(lang, "choose_account"))
 	messageConfig.ChatID = message.Chat.ID
 	messageConfig.ReplyToMessageID = message.MessageID
 	messageConfig.ReplyMarkup = inlineKeyboardMarkup
@@ -655,7 +1459,7 @@ func sendAccountButtonsMessage(prefix string, client Client, message tgbotapi.Me
 	return messageConfig, nil
 }
 
-func buildAccountButtons[V tgbotapi.EditMessageTextConfig | tgbotapi.MessageConfig](prefix string, client Client, message tgbotapi.Message) (*V, *tgbotapi.InlineKeyboardMarkup, error) {
+func buildAccountButtons[V tgbotapi.EditMessageTextConfig | tgbotapi.MessageConfig](prefix string, client Client, lang Lang, filter func(ClientInfo) ClientInfo, newSession func(clientID uint32, account string) (string, error)) (*V, *tgbotapi.InlineKeyboardMarkup, error) {
 	buttons := []tgbotapi.InlineKeyboardButton{}
 
 	info, err := client.GetInfo()
@@ -663,18 +1467,19 @@ func buildAccountButtons[V tgbotapi.EditMessageTextConfig | tgbotapi.MessageConf
 		return nil, nil, err
 	}
 
+	// only the visible accounts
+	info = filter(info)
+
 	for _, account := range info.Accounts {
-		callbackData := callbackQueryDataBuilder(prefix, pageData{
-			Page:     0,
-			Period:   "",
-			ChatID:   message.Chat.ID,
-			FromID:   message.From.ID,
-			ClientID: uint32(client.GetID()),
-			Account:  account.ID,
-		})
+		session, err := newSession(client.GetID(), account.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		callbackData := callbackQueryDataBuilder(prefix, pageData{Session: session})
 
 		buttons = append(buttons, tgbotapi.InlineKeyboardButton{
-			Text:         fmt.Sprintf("%s%s", NormalizePrice(account.Balance), GetCurrencySymbol(account.CurrencyCode)),
+			Text:         fmt.Sprintf("%s%s", FormatPrice(lang, account.Balance), GetCurrencySymbol(account.CurrencyCode)),
 			CallbackData: &callbackData,
 		})
 	}
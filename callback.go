@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	callbacksBucket = "callbacks"
+
+	// callbackVersion is the first field of the callback data, the buttons of other versions are outdated
+	callbackVersion = "1"
+	// the limit of telegram to the callback data
+	callbackDataMaxLength = 64
+
+	callbackTTL         = 48 * time.Hour
+	callbackSessionSize = 6
+)
+
+var errCallbackOutdated = errors.New("the button is outdated")
+
+// callbackPrefixes are the actions of the buttons
+var callbackPrefixes = []string{
+	"bc", // balance of the client
+	"rc", // report of the client
+	"ra", // report of the account
+	"rp", // report of the period
+	"rr", // report page
+	"rd", // detail of the report item, the page is the number of the item, the session has the ids of the items
+	"rk", // categories of the report item, the page is the number of the item, the session has the ids of the items
+	"rs", // category of the report item, the page is the category, the session has the item and the categories
+	"sr", // page of the search results, the session has no client
+}
+
+// callbackSession is the state of the button stored on the server, the callback data has only its id
+type callbackSession struct {
+	ClientID   uint32        `json:"clientId"`
+	Account    string        `json:"account,omitempty"`
+	Tag        string        `json:"tag,omitempty"`        // the filter of the report
+	Query      string        `json:"query,omitempty"`      // the query of the search
+	Items      []string      `json:"items,omitempty"`      // the statement ids of the report items of the buttons
+	Offset     int           `json:"offset,omitempty"`     // the number of the report items before the first one of the ids
+	Categories []string      `json:"categories,omitempty"` // the categories of the category buttons
+	Results    []string      `json:"results,omitempty"`    // the ids of the found statement items of the search
+	Totals     []SearchTotal `json:"totals,omitempty"`     // the sums of the found items of the search
+	ExpiresAt  time.Time     `json:"expiresAt"`
+}
+
+// pageData is the decoded callback data, the client and the account are set by the session
+type pageData struct {
+	Prefix     string
+	Session    string
+	Period     string
+	Page       int
+	ClientID   uint32
+	Account    string
+	Tag        string
+	Query      string
+	Items      []string
+	Offset     int
+	Categories []string
+	Results    []string
+	Totals     []SearchTotal
+}
+
+func callbackQueryDataParser(data string) (pageData, error) {
+	// version + prefix + session + period + page
+	// example: 1:rr:Ab3_x-9Q:6:2
+	if len(data) > callbackDataMaxLength {
+		return pageData{}, errCallbackOutdated
+	}
+
+	arr := strings.Split(data, ":")
+	if len(arr) != 5 || arr[0] != callbackVersion || !contains(callbackPrefixes, arr[1]) {
+		return pageData{}, errCallbackOutdated
+	}
+
+	if session, err := base64.RawURLEncoding.DecodeString(arr[2]); err != nil || len(session) != callbackSessionSize {
+		return pageData{}, errCallbackOutdated
+	}
+
+	period := ""
+	if arr[3] != "" {
+		i, err := strconv.Atoi(arr[3])
+		if err != nil || i < 0 || i >= len(reportPeriods) {
+			return pageData{}, errCallbackOutdated
+		}
+		period = reportPeriods[i]
+	}
+
+	page := 0
+	if arr[4] != "" {
+		var err error
+		if page, err = strconv.Atoi(arr[4]); err != nil || page < 0 {
+			return pageData{}, errCallbackOutdated
+		}
+	}
+
+	return pageData{
+		Prefix:  arr[1],
+		Session: arr[2],
+		Period:  period,
+		Page:    page,
+	}, nil
+}
+
+// itemID returns the statement id of the report item by its number in the period,
+// the buttons of the items which are not in the session are outdated
+func (d pageData) itemID(number int) (string, error) {
+	i := number - 1 - d.Offset
+	if i < 0 || i >= len(d.Items) {
+		return "", errCallbackOutdated
+	}
+
+	return d.Items[i], nil
+}
+
+// callbackQueryDataBuilder returns the callback data without the page, the page number is appended to it
+func callbackQueryDataBuilder(prefix string, data pageData) string {
+	period := ""
+	for i, p := range reportPeriods {
+		if p == data.Period {
+			period = strconv.Itoa(i)
+		}
+	}
+
+	return fmt.Sprintf("%s:%s:%s:%s:", callbackVersion, prefix, data.Session, period)
+}
+
+// newCallbackSession saves the state of the button and returns its id
+func (b *bot) newCallbackSession(clientID uint32, account, tag string) (string, error) {
+	return b.saveCallbackSession(callbackSession{ClientID: clientID, Account: account, Tag: tag})
+}
+
+// saveCallbackSession saves the session with a new id and the expiration time
+func (b *bot) saveCallbackSession(session callbackSession) (string, error) {
+	id := make([]byte, callbackSessionSize)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	session.ExpiresAt = time.Now().Add(callbackTTL)
+	key := base64.RawURLEncoding.EncodeToString(id)
+
+	return key, b.storage.Put(callbacksBucket, key, session)
+}
+
+// sessionWithTag returns the constructor of the sessions with the tag of the report
+func (b *bot) sessionWithTag(tag string) func(clientID uint32, account string) (string, error) {
+	return func(clientID uint32, account string) (string, error) {
+		return b.newCallbackSession(clientID, account, tag)
+	}
+}
+
+// parseCallback decodes the callback data and sets the client and the account of the session
+func (b *bot) parseCallback(data string) (pageData, error) {
+	callbackData, err := callbackQueryDataParser(data)
+	if err != nil {
+		return callbackData, err
+	}
+
+	var session callbackSession
+	ok, err := b.storage.Get(callbacksBucket, callbackData.Session, &session)
+	if err != nil {
+		return callbackData, err
+	}
+
+	// the expired sessions are removed by pruneCallbacks
+	if !ok || time.Now().After(session.ExpiresAt) {
+		return callbackData, errCallbackOutdated
+	}
+
+	callbackData.ClientID = session.ClientID
+	callbackData.Account = session.Account
+	callbackData.Tag = session.Tag
+	callbackData.Query = session.Query
+	callbackData.Items = session.Items
+	callbackData.Offset = session.Offset
+	callbackData.Categories = session.Categories
+	callbackData.Results = session.Results
+	callbackData.Totals = session.Totals
+
+	return callbackData, nil
+}
+
+// pruneCallbacks removes the expired sessions of the buttons
+func (b *bot) pruneCallbacks(now time.Time) error {
+	return b.storage.Update(func(tx StorageTx) error {
+		expired := []string{}
+		err := tx.ForEach(callbacksBucket, func(key string, value []byte) error {
+			var session callbackSession
+			if err := json.Unmarshal(value, &session); err != nil || now.After(session.ExpiresAt) {
+				expired = append(expired, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, key := range expired {
+			if err := tx.Delete(callbacksBucket, key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// answerCallback answers the callback query with the text shown to the user
+func (b *bot) answerCallback(query *tgbotapi.CallbackQuery, text string) {
+	botAPI := b.getBotAPI()
+	if botAPI == nil {
+		return
+	}
+
+	_, err := botAPI.AnswerCallbackQuery(tgbotapi.CallbackConfig{
+		CallbackQueryID: query.ID,
+		Text:            text,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("[telegram] callback answer error")
+	}
+}
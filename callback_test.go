@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestCallbackQueryDataParser(t *testing.T) {
+	var tests = []struct {
+		data   string
+		prefix string
+		period string
+		page   int
+		ok     bool
+	}{
+		{"1:rr:AAAAAAAA:1:2", "rr", "This week", 2, true},
+		{"1:bc:AAAAAAAA::", "bc", "", 0, true},
+		{"1:rp:AAAAAAAA:16:1", "rp", "December", 1, true},
+		{"1:rp:AAAAAAAA:17:1", "", "", 0, false},
+		{"1:rp:AAAAAAAA:-1:1", "", "", 0, false},
+		{"1:rr:AAAAAAAA:1:-2", "", "", 0, false},
+		{"1:xx:AAAAAAAA::", "", "", 0, false},
+		{"1:bc:AAAA::", "", "", 0, false},
+		{"2:bc:AAAAAAAA::", "", "", 0, false},
+		{"rp:This_week:0:0:123:account:1", "", "", 0, false},
+		{"1:rr", "", "", 0, false},
+		{"", "", "", 0, false},
+		{"1:rr:AAAAAAAA:1:" + strings.Repeat("1", 60), "", "", 0, false},
+	}
+
+	for _, test := range tests {
+		data, err := callbackQueryDataParser(test.data)
+		if (err == nil) != test.ok || data.Prefix != test.prefix || data.Period != test.period || data.Page != test.page {
+			t.Error("For", test.data, "expected", test.prefix, test.period, test.page, test.ok, "got", data, err)
+		}
+	}
+}
+
+func TestCallbackQueryDataBuilder(t *testing.T) {
+	data := callbackQueryDataBuilder("rr", pageData{Session: "AAAAAAAA", Period: "Last month"}) + "3"
+	if data != "1:rr:AAAAAAAA:4:3" {
+		t.Error("Expected 1:rr:AAAAAAAA:4:3, got ", data)
+	}
+
+	parsed, err := callbackQueryDataParser(data)
+	if err != nil || parsed.Period != "Last month" || parsed.Page != 3 {
+		t.Error("Expected Last month page 3, got ", parsed, err)
+	}
+}
+
+func TestCallbackSession(t *testing.T) {
+	b := newTestInviteBot(t)
+
+	session, err := b.newCallbackSession(5, "account", "vacation")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := b.parseCallback(callbackQueryDataBuilder("ra", pageData{Session: session}))
+	if err != nil || data.ClientID != 5 || data.Account != "account" || data.Tag != "vacation" {
+		t.Error("Expected client 5, account and vacation, got ", data, err)
+	}
+
+	if _, err := b.parseCallback("1:ra:AAAAAAAA::"); err != errCallbackOutdated {
+		t.Error("Expected errCallbackOutdated, got ", err)
+	}
+
+	if err := b.pruneCallbacks(time.Now().Add(callbackTTL + time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.parseCallback(callbackQueryDataBuilder("ra", pageData{Session: session})); err != errCallbackOutdated {
+		t.Error("Expected errCallbackOutdated, got ", err)
+	}
+}
+
+func TestCallbackGrant(t *testing.T) {
+	b := newTestInviteBot(t)
+
+	// the command of the owner 1 in the group -5 without a role
+	message := &tgbotapi.Message{
+		Chat:           &tgbotapi.Chat{ID: -5},
+		ReplyToMessage: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: -5}, From: &tgbotapi.User{ID: 1}},
+	}
+
+	if _, ok := b.callbackGrant(&tgbotapi.CallbackQuery{From: &tgbotapi.User{ID: 3}, Message: message}); ok {
+		t.Error("Expected no role of the member pressing the button of the owner")
+	}
+
+	if grant, ok := b.callbackGrant(&tgbotapi.CallbackQuery{From: &tgbotapi.User{ID: 1}, Message: message}); ok {
+		t.Error("Expected no role of the owner in the group without a role, got ", grant)
+	}
+
+	// the private chat of the owner
+	message = &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}}
+	if grant, ok := b.callbackGrant(&tgbotapi.CallbackQuery{From: &tgbotapi.User{ID: 1}, Message: message}); !ok || grant.Role != RoleOwner {
+		t.Error("Expected the role of the owner, got ", grant, ok)
+	}
+}
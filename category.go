@@ -0,0 +1,494 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	categoriesBucket    = "categories"     // the categories of the statement items set by the users
+	categoryRulesBucket = "category_rules" // the rules of the clients by the keys <client id>:<rule id>
+
+	// categoryChoicesMax is the limit of the category buttons, telegram allows 100 buttons with the reset and back ones
+	categoryChoicesMax = 98
+)
+
+var errCategoryRuleEmpty = errors.New("the rule has no conditions")
+
+// categoryKeys are the categories of the catalog in the order of the buttons
+var categoryKeys = []string{
+	"groceries", "restaurants", "clothes", "sport", "cash", "mobile", "transfers",
+	"transport", "fuel", "pharmacy", "beauty", "household", "services", "other",
+}
+
+// categoryIconMap is map to help converting the category to emoji, the icon of MCC is used without the category
+var categoryIconMap = map[string]string{
+	"groceries":   "🍞",
+	"restaurants": "🍔",
+	"clothes":     "👕",
+	"sport":       "🥊",
+	"cash":        "🏧",
+	"mobile":      "📱",
+	"transfers":   "💳",
+	"transport":   "🚌",
+	"fuel":        "⛽",
+	"pharmacy":    "💊",
+	"beauty":      "💋",
+	"household":   "🔧",
+	"services":    "💼",
+	"other":       "🛒",
+}
+
+// CategoryRule sets the category of the statement items of the client by the description, MCC and the IBAN
+// of the counterparty, the empty conditions are not checked
+type CategoryRule struct {
+	ID       int    `json:"id"`
+	ClientID uint32 `json:"clientId"`
+	Category string `json:"category"`
+	Contains string `json:"contains,omitempty"` // a part of the description in any case
+	Mcc      int    `json:"mcc,omitempty"`
+	Iban     string `json:"iban,omitempty"`
+}
+
+// Match checks the conditions of the rule
+func (r CategoryRule) Match(item StatementItem) bool {
+	if r.Contains != "" && !strings.Contains(strings.ToLower(item.Description), strings.ToLower(r.Contains)) {
+		return false
+	}
+
+	if r.Mcc != 0 && r.Mcc != item.Mcc {
+		return false
+	}
+
+	if r.Iban != "" && r.Iban != normalizeIban(item.CounterIban) {
+		return false
+	}
+
+	return true
+}
+
+// String returns the rule in the format of /rule, example: groceries silpo mcc:5411
+func (r CategoryRule) String() string {
+	parts := []string{r.Category}
+	if r.Contains != "" {
+		parts = append(parts, r.Contains)
+	}
+	if r.Mcc != 0 {
+		parts = append(parts, fmt.Sprintf("mcc:%d", r.Mcc))
+	}
+	if r.Iban != "" {
+		parts = append(parts, "iban:"+r.Iban)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// parseCategoryRule parses the arguments of /rule, the first one is the category, the words without a filter are
+// a part of the description, example: rent mcc:4829 iban:UA213223130000026007233566001
+func parseCategoryRule(args []string) (CategoryRule, error) {
+	if len(args) < 2 {
+		return CategoryRule{}, errCategoryRuleEmpty
+	}
+
+	rule := CategoryRule{Category: parseCategory(args[0])}
+
+	words := []string{}
+	for _, arg := range args[1:] {
+		switch {
+		case strings.HasPrefix(strings.ToLower(arg), "mcc:"):
+			mcc, err := strconv.Atoi(arg[len("mcc:"):])
+			if err != nil || mcc <= 0 {
+				return CategoryRule{}, fmt.Errorf("incorrect mcc %s", arg)
+			}
+			rule.Mcc = mcc
+		case strings.HasPrefix(strings.ToLower(arg), "iban:"):
+			rule.Iban = normalizeIban(arg[len("iban:"):])
+		default:
+			words = append(words, arg)
+		}
+	}
+	rule.Contains = strings.Join(words, " ")
+
+	if rule.Contains == "" && rule.Mcc == 0 && rule.Iban == "" {
+		return CategoryRule{}, errCategoryRuleEmpty
+	}
+
+	return rule, nil
+}
+
+func normalizeIban(iban string) string {
+	return strings.ToUpper(strings.ReplaceAll(iban, " ", ""))
+}
+
+// parseCategory returns the category of the catalog by its key or its name in any language,
+// other names are the custom categories, example: Продукти is groceries
+func parseCategory(text string) string {
+	text = strings.ToLower(strings.TrimSpace(text))
+	for _, key := range categoryKeys {
+		if text == key {
+			return key
+		}
+
+		for _, catalog := range catalogs {
+			if strings.ToLower(catalog["category."+key]) == text {
+				return key
+			}
+		}
+	}
+
+	return text
+}
+
+// CategoryLabel returns the name of the category in the language, the custom categories are not translated
+func CategoryLabel(lang Lang, category string) string {
+	if _, ok := catalogs[fallbackLang]["category."+category]; !ok {
+		return category
+	}
+
+	return T(lang, "category."+category)
+}
+
+// ItemCategory returns the category of the statement item, the category of MCC if it is not set
+func ItemCategory(item StatementItem) string {
+	if item.Category != "" {
+		return item.Category
+	}
+
+	return GetCategory(item.Mcc)
+}
+
+// categoryRuleKey returns the storage key of the rule, the rules of a client are not visible to other clients
+func categoryRuleKey(clientID uint32, id int) string {
+	return fmt.Sprintf("%d:%d", clientID, id)
+}
+
+// getCategoryRules returns the rules of the client ordered by the id, the first matched rule sets the category
+func (b *bot) getCategoryRules(clientID uint32) ([]CategoryRule, error) {
+	prefix := fmt.Sprintf("%d:", clientID)
+
+	rules := []CategoryRule{}
+	err := b.storage.ForEach(categoryRulesBucket, func(key string, value []byte) error {
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		var rule CategoryRule
+		if err := json.Unmarshal(value, &rule); err != nil {
+			return nil
+		}
+
+		rules = append(rules, rule)
+		return nil
+	})
+
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+
+	return rules, err
+}
+
+// addCategoryRule saves the rule of the client with a new id
+func (b *bot) addCategoryRule(rule CategoryRule) (CategoryRule, error) {
+	err := b.storage.Update(func(tx StorageTx) error {
+		id, err := tx.NextSequence(categoryRulesBucket)
+		if err != nil {
+			return err
+		}
+
+		rule.ID = int(id)
+		return tx.Put(categoryRulesBucket, categoryRuleKey(rule.ClientID, rule.ID), rule)
+	})
+
+	return rule, err
+}
+
+// deleteCategoryRule removes the rule of the client, false is returned if it does not exist
+func (b *bot) deleteCategoryRule(clientID uint32, id int) (bool, error) {
+	key := categoryRuleKey(clientID, id)
+
+	var ok bool
+	err := b.storage.Update(func(tx StorageTx) error {
+		var err error
+		if ok, err = tx.Get(categoryRulesBucket, key, &CategoryRule{}); err != nil || !ok {
+			return err
+		}
+
+		return tx.Delete(categoryRulesBucket, key)
+	})
+
+	return ok, err
+}
+
+// setItemCategory saves the category of the statement item, the empty category returns the item to the rules and MCC
+func (b *bot) setItemCategory(statementID, category string) error {
+	if category == "" {
+		return b.storage.Delete(categoriesBucket, statementID)
+	}
+
+	return b.storage.Put(categoriesBucket, statementID, category)
+}
+
+// categorizer returns the function setting the categories of the items of the client, the category of the user
+// takes precedence over the rules, the rules are loaded once for all items
+func (b *bot) categorizer(clientID uint32) func(item *StatementItem) {
+	rules, err := b.getCategoryRules(clientID)
+	if err != nil {
+		log.Error().Err(err).Msg("[category] get rules")
+	}
+
+	return func(item *StatementItem) {
+		item.Category = ""
+
+		if ok, err := b.storage.Get(categoriesBucket, item.ID, &item.Category); err != nil {
+			log.Error().Err(err).Msg("[category] get category")
+		} else if ok {
+			return
+		}
+
+		for _, rule := range rules {
+			if rule.Match(*item) {
+				item.Category = rule.Category
+				return
+			}
+		}
+	}
+}
+
+// clientsCategorizer returns the function setting the categories of the items of any clients,
+// the rules of each client are loaded once
+func (b *bot) clientsCategorizer() func(clientID uint32, item *StatementItem) {
+	categorizers := map[uint32]func(item *StatementItem){}
+
+	return func(clientID uint32, item *StatementItem) {
+		categorize, ok := categorizers[clientID]
+		if !ok {
+			categorize = b.categorizer(clientID)
+			categorizers[clientID] = categorize
+		}
+
+		categorize(item)
+	}
+}
+
+// categoryChoices returns the categories of the buttons, the catalog ones and the custom ones of the rules of the client
+func (b *bot) categoryChoices(clientID uint32) []string {
+	choices := append([]string{}, categoryKeys...)
+
+	rules, err := b.getCategoryRules(clientID)
+	if err != nil {
+		log.Error().Err(err).Msg("[category] get rules")
+	}
+
+	for _, rule := range rules {
+		if len(choices) < categoryChoicesMax && !contains(choices, rule.Category) {
+			choices = append(choices, rule.Category)
+		}
+	}
+
+	return choices
+}
+
+// categoryKeyboard saves the session of the category buttons of the report item with its id and the categories,
+// the categories of the rules may change before the click
+func (b *bot) categoryKeyboard(report Report, update tgbotapi.Update, lang Lang, data pageData) (tgbotapi.InlineKeyboardMarkup, error) {
+	statementID, err := data.itemID(data.Page)
+	if err != nil {
+		return tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	if _, err := report.GetItem(update, statementID); err != nil {
+		return tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	choices := b.categoryChoices(data.ClientID)
+	data.Session, err = b.saveCallbackSession(callbackSession{
+		ClientID:   data.ClientID,
+		Account:    data.Account,
+		Tag:        data.Tag,
+		Items:      []string{statementID},
+		Offset:     data.Page - 1,
+		Categories: choices,
+	})
+	if err != nil {
+		return tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	return categoryButtons(lang, data, choices), nil
+}
+
+// categoryButtons returns the category buttons of the report item, the page is the number of the category from 1,
+// the first button returns the item to the rules and MCC
+func categoryButtons(lang Lang, data pageData, choices []string) tgbotapi.InlineKeyboardMarkup {
+	button := func(text string, prefix string, page int) tgbotapi.InlineKeyboardButton {
+		d := callbackQueryDataBuilder(prefix, data) + strconv.Itoa(page)
+		return tgbotapi.InlineKeyboardButton{Text: text, CallbackData: &d}
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	row := []tgbotapi.InlineKeyboardButton{}
+	for i, category := range choices {
+		row = append(row, button(CategoryLabel(lang, category), "rs", i+1))
+		if len(row) == 3 {
+			rows = append(rows, row)
+			row = []tgbotapi.InlineKeyboardButton{}
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	return tgbotapi.InlineKeyboardMarkup{InlineKeyboard: append(rows, tgbotapi.NewInlineKeyboardRow(
+		button(T(lang, "category_auto"), "rs", 0),
+		button(T(lang, "back"), "rd", data.Page),
+	))}
+}
+
+// chooseCategory saves the category of the page of the category button to the item of the session
+func (b *bot) chooseCategory(report Report, update tgbotapi.Update, data pageData) error {
+	statementID, err := data.itemID(data.Offset + 1)
+	if err != nil {
+		return err
+	}
+
+	item, err := report.GetItem(update, statementID)
+	if err != nil {
+		return err
+	}
+
+	category := ""
+	if data.Page > 0 {
+		if data.Page > len(data.Categories) {
+			return errCallbackOutdated
+		}
+		category = data.Categories[data.Page-1]
+	}
+
+	return b.setItemCategory(item.ID, category)
+}
+
+// cmdRules sends the category rules of the visible clients with the commands to delete them
+func (b *bot) cmdRules(c commandContext) {
+	clients := b.visibleClients(c.Grant)
+
+	lines := []string{T(c.Lang, "rules")}
+	for _, client := range clients {
+		rules, err := b.getCategoryRules(client.GetID())
+		if err != nil {
+			log.Error().Err(err).Msg("[category] get rules")
+			b.reply(c.Message, T(c.Lang, "error"))
+			return
+		}
+
+		if len(rules) > 0 && len(clients) > 1 {
+			lines = append(lines, client.GetName()+":")
+		}
+
+		for _, rule := range rules {
+			lines = append(lines, fmt.Sprintf("/delete_rule_%d %s → %s", rule.ID, rule, CategoryLabel(c.Lang, rule.Category)))
+		}
+	}
+
+	if len(lines) == 1 {
+		b.reply(c.Message, T(c.Lang, "rules_empty"))
+		return
+	}
+
+	b.reply(c.Message, strings.Join(lines, "\n"))
+}
+
+// parseRuleClient splits the client of the rule from the arguments of /rule, example: client:family,
+// the empty ref is the first visible client
+func parseRuleClient(args []string) (string, []string) {
+	ref := ""
+	rest := []string{}
+	for _, arg := range args {
+		if strings.HasPrefix(strings.ToLower(arg), "client:") {
+			ref = arg[len("client:"):]
+			continue
+		}
+
+		rest = append(rest, arg)
+	}
+
+	return ref, rest
+}
+
+// ruleClient returns the visible client of the rule by the index or the alias, the first visible client without the ref
+func (b *bot) ruleClient(ref string, grant AccessConfig) (Client, error) {
+	if ref != "" {
+		return b.getClientByRef(ref, grant)
+	}
+
+	clients := b.visibleClients(grant)
+	if len(clients) == 0 {
+		return nil, errors.New("Client does not found")
+	}
+
+	return clients[0], nil
+}
+
+// cmdRule adds the category rule of the client, example: /rule groceries silpo client:family
+func (b *bot) cmdRule(c commandContext) {
+	ref, args := parseRuleClient(c.Args)
+
+	rule, err := parseCategoryRule(args)
+	if err != nil {
+		b.reply(c.Message, T(c.Lang, "rule_usage"))
+		return
+	}
+
+	client, err := b.ruleClient(ref, c.Grant)
+	if err != nil {
+		b.reply(c.Message, err.Error())
+		return
+	}
+	rule.ClientID = client.GetID()
+
+	rule, err = b.addCategoryRule(rule)
+	if err != nil {
+		log.Error().Err(err).Msg("[category] add rule")
+		b.reply(c.Message, T(c.Lang, "error"))
+		return
+	}
+
+	log.Info().Msgf("[category] rule %d of the client %d added by %d", rule.ID, rule.ClientID, c.Message.From.ID)
+	b.reply(c.Message, T(c.Lang, "rule_added", rule.ID, CategoryLabel(c.Lang, rule.Category), client.GetName()))
+}
+
+// cmdDeleteRule removes the category rule of a visible client by the suffix, the rules are sent without it,
+// example: /delete_rule_1
+func (b *bot) cmdDeleteRule(c commandContext) {
+	if c.Suffix == "" {
+		b.cmdRules(c)
+		return
+	}
+
+	id, err := strconv.Atoi(c.Suffix)
+	if err != nil {
+		b.reply(c.Message, T(c.Lang, "rule_not_found"))
+		return
+	}
+
+	for _, client := range b.visibleClients(c.Grant) {
+		ok, err := b.deleteCategoryRule(client.GetID(), id)
+		if err != nil {
+			log.Error().Err(err).Msg("[category] delete rule")
+			b.reply(c.Message, T(c.Lang, "error"))
+			return
+		}
+
+		if ok {
+			log.Info().Msgf("[category] rule %d deleted by %d", id, c.Message.From.ID)
+			b.reply(c.Message, T(c.Lang, "rule_deleted"))
+			return
+		}
+	}
+
+	b.reply(c.Message, T(c.Lang, "rule_not_found"))
+}
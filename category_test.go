@@ -0,0 +1,211 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCategoryRule(t *testing.T) {
+	var tests = []struct {
+		args     string
+		expected CategoryRule
+		ok       bool
+	}{
+		{"groceries silpo", CategoryRule{Category: "groceries", Contains: "silpo"}, true},
+		{"Продукти Сільпо Київ", CategoryRule{Category: "groceries", Contains: "Сільпо Київ"}, true},
+		{"rent mcc:4829 iban:ua21", CategoryRule{Category: "rent", Mcc: 4829, Iban: "UA21"}, true},
+		{"rent MCC:x", CategoryRule{}, false},
+		{"rent", CategoryRule{}, false},
+	}
+
+	for _, test := range tests {
+		rule, err := parseCategoryRule(strings.Fields(test.args))
+		if (err == nil) != test.ok || !reflect.DeepEqual(rule, test.expected) {
+			t.Error("For", test.args, "expected", test.expected, "got", rule, err)
+		}
+	}
+}
+
+func TestCategoryRuleMatch(t *testing.T) {
+	item := StatementItem{Description: "Сільпо", Mcc: 4829, CounterIban: "UA213223130000026007233566001"}
+
+	var tests = []struct {
+		rule     CategoryRule
+		expected bool
+	}{
+		{CategoryRule{Contains: "сільпо"}, true},
+		{CategoryRule{Mcc: 4829, Iban: "UA213223130000026007233566001"}, true},
+		{CategoryRule{Mcc: 4829, Iban: "UA00"}, false},
+		{CategoryRule{Contains: "atb", Mcc: 4829}, false},
+	}
+
+	for _, test := range tests {
+		if match := test.rule.Match(item); match != test.expected {
+			t.Error("For", test.rule, "expected", test.expected, "got", match)
+		}
+	}
+}
+
+func TestCategorizer(t *testing.T) {
+	b := newTestInviteBot(t)
+
+	for _, args := range []string{"pharmacy аптека", "rent mcc:4829", "groceries аптека"} {
+		rule, _ := parseCategoryRule(strings.Fields(args))
+		rule.ClientID = 1
+		if _, err := b.addCategoryRule(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items := []StatementItem{
+		{ID: "st1", Description: "Аптека Доброго Дня", Mcc: 5411},
+		{ID: "st2", Description: "Оренда", Mcc: 4829},
+		{ID: "st3", Description: "АТБ", Mcc: 5411},
+	}
+	if err := b.setItemCategory("st2", "household"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the category of the user takes precedence over the rules, the first rule is used
+	categorize := b.categorizer(1)
+	categories := []string{}
+	for i := range items {
+		categorize(&items[i])
+		categories = append(categories, ItemCategory(items[i]))
+	}
+
+	if expected := []string{"pharmacy", "household", "groceries"}; !reflect.DeepEqual(categories, expected) {
+		t.Error("Expected", expected, "got", categories)
+	}
+
+	if icon := GetIconByStatementItem(StatementItem{Mcc: 5411, Category: "rent"}); icon != "🏷" {
+		t.Error("Expected the icon of the custom category, got ", icon)
+	}
+
+	// the rules of the client are not used for other clients
+	item := StatementItem{ID: "st4", Description: "Аптека", Mcc: 5411}
+	if b.categorizer(2)(&item); item.Category != "" {
+		t.Error("Expected no category of the rules of another client, got ", item.Category)
+	}
+
+	if ok, _ := b.deleteCategoryRule(2, 1); ok {
+		t.Error("Expected no deleted rule of another client")
+	}
+
+	if ok, err := b.deleteCategoryRule(1, 1); !ok || err != nil {
+		t.Error("Expected the deleted rule, got ", ok, err)
+	}
+
+	if ok, _ := b.deleteCategoryRule(1, 1); ok {
+		t.Error("Expected no deleted rule")
+	}
+
+	if choices := b.categoryChoices(1); choices[len(choices)-1] != "rent" || len(choices) != len(categoryKeys)+1 {
+		t.Error("Expected the catalog and the custom categories, got ", choices)
+	}
+
+	if choices := b.categoryChoices(2); len(choices) != len(categoryKeys) {
+		t.Error("Expected the catalog categories of another client, got ", choices)
+	}
+}
+
+func TestChooseCategory(t *testing.T) {
+	b := newTestInviteBot(t)
+
+	r := NewReport("account", 1)
+	update := newTestReportUpdate("1:rp:AAAAAAAA:0:1")
+	r.SetGridData(update, []StatementItem{{ID: "st1", Mcc: 5411}, {ID: "st2", Mcc: 5912}})
+
+	// the detail has the button of the categories
+	tmpl, err := GetTempate(detailTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	detail := pageData{Session: "AAAAAAAA", Period: "Today", Page: 2, Items: []string{"st1", "st2"}}
+	view := ReportView{Tmpl: tmpl, Lang: LangEN, Categorize: b.categorizer(0)}
+	message, err := r.GetItemDetail(update, detail, view, "Name", Account{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if button := message.ReplyMarkup.InlineKeyboard[0][1]; *button.CallbackData != "1:rk:AAAAAAAA:0:2" {
+		t.Error("Expected 1:rk:AAAAAAAA:0:2, got ", *button.CallbackData)
+	}
+
+	keyboard, err := b.categoryKeyboard(r, update, LangEN, detail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clothes := *keyboard.InlineKeyboard[0][2].CallbackData
+	if button := keyboard.InlineKeyboard[0][2]; button.Text != "Clothes" || !strings.HasPrefix(clothes, "1:rs:") || !strings.HasSuffix(clothes, ":0:3") {
+		t.Error("Expected Clothes of the 2nd item, got ", button.Text, clothes)
+	}
+
+	// a new statement and a new rule do not change the item and the category of the button
+	r.SetGridData(update, []StatementItem{{ID: "st0"}, {ID: "st1", Mcc: 5411}, {ID: "st2", Mcc: 5912}})
+	if _, err := b.addCategoryRule(CategoryRule{Category: "rent", Mcc: 4829}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := b.parseCallback(clothes)
+	if err := b.chooseCategory(r, update, data); err != nil {
+		t.Fatal("Expected the category of the 2nd item, got ", err)
+	}
+
+	var category string
+	if ok, _ := b.storage.Get(categoriesBucket, "st2", &category); !ok || category != "clothes" {
+		t.Error("Expected clothes of st2, got ", category)
+	}
+
+	// the detail is shown again with the item of the session
+	data.Page = data.Offset + 1
+	message, err = r.GetItemDetail(update, data, ReportView{Tmpl: tmpl, Lang: LangEN, Categorize: b.categorizer(0)}, "Name", Account{})
+	if err != nil || !strings.Contains(message.Text, "Category: Clothes") {
+		t.Error("Expected the chosen category, got ", message.Text, err)
+	}
+
+	// the first button returns the item to MCC
+	auto := keyboard.InlineKeyboard[len(keyboard.InlineKeyboard)-1][0]
+	data, _ = b.parseCallback(*auto.CallbackData)
+	if err := b.chooseCategory(r, update, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := b.storage.Get(categoriesBucket, "st2", new(string)); ok {
+		t.Error("Expected no category of the user")
+	}
+
+	data.Page = len(data.Categories) + 1
+	if err := b.chooseCategory(r, update, data); err != errCallbackOutdated {
+		t.Error("Expected errCallbackOutdated, got ", err)
+	}
+
+	// the item is not in the period anymore
+	r.SetGridData(update, []StatementItem{{ID: "st1"}})
+	data.Page = 1
+	if err := b.chooseCategory(r, update, data); err != errCallbackOutdated {
+		t.Error("Expected errCallbackOutdated, got ", err)
+	}
+}
+
+func TestParseRuleClient(t *testing.T) {
+	var tests = []struct {
+		args     string
+		ref      string
+		expected string
+	}{
+		{"groceries silpo", "", "groceries silpo"},
+		{"groceries silpo client:family", "family", "groceries silpo"},
+		{"rent Client:1 mcc:4829", "1", "rent mcc:4829"},
+	}
+
+	for _, test := range tests {
+		ref, args := parseRuleClient(strings.Fields(test.args))
+		if ref != test.ref || strings.Join(args, " ") != test.expected {
+			t.Error("For", test.args, "expected", test.ref, test.expected, "got", ref, args)
+		}
+	}
+}
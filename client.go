@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"hash/fnv"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -28,6 +30,13 @@ type StatementItem struct {
 	CashbackAmount  int    `json:"cashbackAmount"`
 	Balance         int    `json:"balance"`
 	Hold            bool   `json:"hold"`
+	CounterIban     string `json:"counterIban,omitempty"`
+
+	// the annotation of the users, it is not a part of the monobank data
+	Note     string   `json:"-"`
+	Tags     []string `json:"-"`
+	Receipts int      `json:"-"` // the number of the attached receipts
+	Category string   `json:"-"` // the category of the user or the rules, the category of MCC if it is empty
 }
 
 // Account is a account information
@@ -44,6 +53,7 @@ type Account struct {
 
 // ClientInfo is a client information
 type ClientInfo struct {
+	ClientID   string    `json:"clientId"`
 	Name       string    `json:"name"`
 	WebHookURL string    `json:"webHookUrl,omitempty"`
 	Accounts   []Account `json:"accounts"`
@@ -59,35 +69,64 @@ type WebHookResponse struct {
 type Client interface {
 	Init() error
 	GetID() uint32
+	GetAlias() string
+	GetDefaultAccount() string
 	GetReport(accountId string) Report
 	GetInfo() (ClientInfo, error)
+	RefreshInfo(ctx context.Context) (ClientInfo, error)
 	GetStatement(command, accountId string) ([]StatementItem, error)
 	SetWebHook(url string) (WebHookResponse, error)
 	GetName() string
 
 	ResetReport(accountId string)
 	GetAccountByID(id string) (*Account, error)
+	OnInfo(handler func(ClientInfo))
+	GetStatus() ComponentStatus
 }
 
 type client struct {
-	Info    *ClientInfo
-	id      uint32
-	token   string
-	limiter *rate.Limiter
-	reports map[string]Report
+	// mu guards the info and the id set by the first info, the webhooks and the updates read them concurrently
+	mu   sync.RWMutex
+	Info *ClientInfo
+	id   uint32
+
+	alias          string
+	defaultAccount string
+	token          string
+	limiter        *rate.Limiter
+	reports        map[string]Report
+
+	infoHandlers []func(ClientInfo)
+
+	status *apiStatus
+}
+
+// apiStatus is a status of the last monobank api call of the client
+type apiStatus struct {
+	mu     sync.Mutex
+	status ComponentStatus
 }
 
 // NewClient returns a client object.
-func NewClient(token string) Client {
+func NewClient(config ClientConfig) Client {
 
-	h := fnv.New32a()
-	h.Write([]byte(token))
+	// the alias is a stable identity of the client, the monobank client id is used
+	// if it is not set, the token is never used as the identity
+	var id uint32
+	if config.Alias != "" {
+		id = hashID(config.Alias)
+	}
 
 	return &client{
-		limiter: rate.NewLimiter(rate.Every(time.Second*30), 1),
-		token:   token,
-		id:      h.Sum32(),
-		reports: make(map[string]Report),
+		limiter:        rate.NewLimiter(rate.Every(time.Second*30), 1),
+		token:          config.Token,
+		id:             id,
+		alias:          config.Alias,
+		defaultAccount: config.DefaultAccount,
+		reports:        make(map[string]Report),
+		status: &apiStatus{
+			status: ComponentStatus{Status: statusStarting, UpdatedAt: time.Now()},
+		},
 	}
 }
 
@@ -96,10 +135,57 @@ func (c *client) Init() error {
 	return err
 }
 
-func (c client) GetID() uint32 {
+// setInfo saves the client information and notifies the handlers
+func (c *client) setInfo(info ClientInfo) {
+	// the id is set by the first successful info, the failed requests do not set the info
+	c.mu.Lock()
+	if c.id == 0 && c.alias == "" && info.ClientID != "" {
+		c.id = hashID(info.ClientID)
+	}
+	c.Info = &info
+	c.mu.Unlock()
+
+	for _, handler := range c.infoHandlers {
+		handler(info)
+	}
+}
+
+// hashID returns a short id of the value to use in the callback data
+func hashID(value string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(value))
+	return h.Sum32()
+}
+
+func (c *client) GetID() uint32 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	return c.id
 }
 
+// cachedInfo returns the last received client information without a request
+func (c *client) cachedInfo() (ClientInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.Info == nil {
+		return ClientInfo{}, false
+	}
+
+	return *c.Info, true
+}
+
+// GetAlias returns the alias of the client from the configuration
+func (c *client) GetAlias() string {
+	return c.alias
+}
+
+// GetDefaultAccount returns id of the account used by the report without choosing
+func (c *client) GetDefaultAccount() string {
+	return c.defaultAccount
+}
+
 func (c *client) GetReport(accountId string) Report {
 	if _, ok := c.reports[accountId]; !ok {
 		c.reports[accountId] = NewReport(accountId, c.id)
@@ -112,28 +198,73 @@ func (c *client) GetInfo() (ClientInfo, error) {
 	if c.limiter.Allow() {
 		log.Debug().Msg("[monoapi] get info")
 		info, err := c.getClientInfo()
-		c.Info = &info
-		return info, err
+		if err != nil {
+			return info, err
+		}
+
+		c.setInfo(info)
+		return info, nil
 	}
 
-	if c.Info != nil {
-		return *c.Info, nil
+	rateLimiterRejections.WithLabelValues("personal/client-info").Inc()
+
+	if info, ok := c.cachedInfo(); ok {
+		return info, nil
 	}
 
 	log.Warn().Msg("[monoapi] get info, waiting")
 	return ClientInfo{}, errors.New("please waiting and then try again")
 }
 
+// RefreshInfo waits for the rate limiter and gets the client information
+func (c *client) RefreshInfo(ctx context.Context) (ClientInfo, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return ClientInfo{}, err
+	}
+
+	log.Debug().Msg("[monoapi] refresh info")
+	info, err := c.getClientInfo()
+	if err != nil {
+		return info, err
+	}
+
+	c.setInfo(info)
+	return info, nil
+}
+
+// clientKey returns the alias of the client or the id if the alias is not set
+func clientKey(client Client) string {
+	if alias := client.GetAlias(); alias != "" {
+		return alias
+	}
+
+	return fmt.Sprintf("%d", client.GetID())
+}
+
+// OnInfo registers a handler called on every refresh of the client information
+func (c *client) OnInfo(handler func(ClientInfo)) {
+	c.infoHandlers = append(c.infoHandlers, handler)
+}
+
+// GetStatus returns a status of the last monobank api call
+func (c *client) GetStatus() ComponentStatus {
+	c.status.mu.Lock()
+	defer c.status.mu.Unlock()
+
+	return c.status.status
+}
+
 // GetName return name of the client
-func (c client) GetName() string {
-	if c.Info == nil {
+func (c *client) GetName() string {
+	info, ok := c.cachedInfo()
+	if !ok {
 		return "NoName"
 	}
-	return c.Info.Name
+	return info.Name
 }
 
 // SetWebHook is a function set up the monobank webhook.
-func (c client) SetWebHook(url string) (WebHookResponse, error) {
+func (c *client) SetWebHook(url string) (WebHookResponse, error) {
 	response := WebHookResponse{}
 
 	payload := strings.NewReader(fmt.Sprintf("{\"webHookUrl\": \"%s\"}", url))
@@ -147,15 +278,18 @@ func (c client) SetWebHook(url string) (WebHookResponse, error) {
 	req.Header.Add("X-Token", c.token)
 	req.Header.Add("content-type", "application/json")
 
-	return DoRequest(response, req)
+	response, err = DoRequest(response, req)
+	c.status.record(err)
+
+	return response, err
 }
 
+// GetAccountByID returns the account of the cached information, the monobank api is not requested
 func (c *client) GetAccountByID(id string) (*Account, error) {
-	if c.Info != nil {
-		for _, account := range c.Info.Accounts {
-			if account.ID == id {
-				return &account, nil
-			}
+	info, _ := c.cachedInfo()
+	for _, account := range info.Accounts {
+		if account.ID == id {
+			return &account, nil
 		}
 	}
 
@@ -166,16 +300,18 @@ func (c *client) ResetReport(accountId string) {
 	c.GetReport(accountId).ResetLastData()
 }
 
-func (c client) GetStatement(command string, accountId string) ([]StatementItem, error) {
+func (c *client) GetStatement(command string, accountId string) ([]StatementItem, error) {
 	if c.limiter.Allow() {
 		return c.getStatement(command, accountId)
 	}
 
+	rateLimiterRejections.WithLabelValues("personal/statement").Inc()
+
 	log.Warn().Msg("[monoapi] statement, waiting")
 	return []StatementItem{}, errors.New("please waiting and then try again")
 }
 
-func (c client) getStatement(command, account string) ([]StatementItem, error) {
+func (c *client) getStatement(command, account string) ([]StatementItem, error) {
 
 	statementItems := []StatementItem{}
 
@@ -200,10 +336,13 @@ func (c client) getStatement(command, account string) ([]StatementItem, error) {
 
 	req.Header.Add("x-token", c.token)
 
-	return DoRequest(statementItems, req)
+	statementItems, err = DoRequest(statementItems, req)
+	c.status.record(err)
+
+	return statementItems, err
 }
 
-func (c client) getClientInfo() (ClientInfo, error) {
+func (c *client) getClientInfo() (ClientInfo, error) {
 	var clientInfo ClientInfo
 
 	url := "https://api.monobank.ua/personal/client-info"
@@ -215,5 +354,25 @@ func (c client) getClientInfo() (ClientInfo, error) {
 
 	req.Header.Add("x-token", c.token)
 
-	return DoRequest(clientInfo, req)
+	clientInfo, err = DoRequest(clientInfo, req)
+	c.status.record(err)
+
+	return clientInfo, err
+}
+
+// record records a result of the api call
+func (s *apiStatus) record(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status.UpdatedAt = time.Now()
+	if err != nil {
+		s.status.Status = statusDown
+		s.status.Error = err.Error()
+		return
+	}
+
+	s.status.Status = statusUp
+	s.status.Error = ""
+	s.status.LastSuccess = s.status.UpdatedAt
 }
@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestClientSetInfo(t *testing.T) {
+	// the info of the failed request does not keep the id of the client unset
+	c := NewClient(ClientConfig{Token: "token"}).(*client)
+	c.Info = &ClientInfo{}
+
+	c.setInfo(ClientInfo{ClientID: "abc"})
+	if c.GetID() != hashID("abc") {
+		t.Error("Expected the id of the client info, got ", c.GetID())
+	}
+
+	// the id is stable
+	c.setInfo(ClientInfo{ClientID: "other"})
+	if c.GetID() != hashID("abc") {
+		t.Error("Expected the first id, got ", c.GetID())
+	}
+
+	family := NewClient(ClientConfig{Alias: "family"}).(*client)
+	family.setInfo(ClientInfo{ClientID: "abc"})
+	if family.GetID() != hashID("family") {
+		t.Error("Expected the id of the alias, got ", family.GetID())
+	}
+}
+
+func TestClientInfoConcurrent(t *testing.T) {
+	// the webhook check refreshes the info while the updates and the webhooks read it
+	c := NewClient(ClientConfig{Alias: "family"}).(*client)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			c.setInfo(ClientInfo{Name: "Family", Accounts: []Account{{ID: "acc"}}})
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		c.GetName()
+		c.GetAccountByID("acc")
+	}
+	<-done
+
+	if _, err := c.GetAccountByID("acc"); err != nil {
+		t.Error("Expected the account, got ", err)
+	}
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/rs/zerolog/log"
+)
+
+// commandAccess is a level of the access to the command
+type commandAccess int
+
+const (
+	// commandRole is allowed to the roles with the command
+	commandRole commandAccess = iota
+	// commandKnown is allowed to the users and chats with any role
+	commandKnown
+	// commandPublic is allowed to everybody
+	commandPublic
+)
+
+// Command is a telegram command handled by the router
+type Command struct {
+	Name    string // the description is the cmd.<name> text of the catalogs
+	Args    string // usage of the arguments in /help, example: [role] [clients]
+	Access  commandAccess
+	Suffix  bool // the name can have a suffix after _, example: /get_webhook_1
+	Own     bool // the command manages the own data of the user, the role of the user is used in the group chats
+	Handler func(c commandContext)
+}
+
+// commandContext is a parsed command of the message
+type commandContext struct {
+	Message *tgbotapi.Message
+	Grant   AccessConfig
+	Lang    Lang
+	Suffix  string   // example: 1 for /get_webhook_1
+	Args    []string // the arguments separated by spaces
+}
+
+// Arg returns the argument by the index or an empty string
+func (c commandContext) Arg(i int) string {
+	if i < len(c.Args) {
+		return c.Args[i]
+	}
+
+	return ""
+}
+
+// commands returns the commands of the bot in the order of /help
+func (b *bot) commands() []Command {
+	commands := []Command{
+		{Name: "start", Args: "[code]", Access: commandPublic, Handler: b.handleStart},
+		{Name: "help", Access: commandKnown, Handler: b.cmdHelp},
+		{Name: "language", Args: "[code]", Access: commandKnown, Handler: b.cmdLanguage},
+		{Name: "timezone", Args: "[name]", Access: commandKnown, Handler: b.cmdTimezone},
+		{Name: "balance", Handler: b.cmdBalance},
+		{Name: "report", Args: "[#tag]", Handler: b.cmdReport},
+		{Name: "receipts", Args: "[yyyy-mm]", Handler: b.cmdReceipts},
+		{Name: "search", Args: "<text> [amount>n] [mcc:code] [from:yyyy-mm-dd] [to:yyyy-mm-dd]", Handler: b.cmdSearch},
+		{Name: "rules", Handler: b.cmdRules},
+		{Name: "rule", Args: "<category> [text] [mcc:code] [iban:iban] [client:n]", Handler: b.cmdRule},
+		{Name: "delete_rule", Args: "[_n]", Suffix: true, Handler: b.cmdDeleteRule},
+		{Name: "get_webhook", Args: "[_n]", Suffix: true, Handler: b.cmdGetWebhook},
+		{Name: "set_webhook", Args: "[_n] <url>", Suffix: true, Handler: b.cmdSetWebhook},
+		{Name: "reload", Handler: b.cmdReload},
+		{Name: "invite", Args: "<role> <clients> [accounts]", Handler: b.handleInvite},
+		{Name: "revoke", Args: "[id or code]", Handler: b.handleRevoke},
+	}
+
+	if b.multiTenant {
+		commands = append(commands,
+			Command{Name: "connect", Args: "[token]", Own: true, Handler: b.handleConnect},
+			Command{Name: "disconnect", Own: true, Handler: b.handleDisconnect},
+			Command{Name: "share", Args: "[chat id]", Own: true, Handler: func(c commandContext) { b.handleShare(c, true) }},
+			Command{Name: "unshare", Args: "[chat id]", Own: true, Handler: func(c commandContext) { b.handleShare(c, false) }},
+		)
+	}
+
+	return commands
+}
+
+// parseCommand parses the command of the text, example: /get_webhook_1@bot https://example.com,
+// the commands to other bots are skipped
+func parseCommand(text, botName string) (name string, args []string, ok bool) {
+	if !strings.HasPrefix(text, "/") {
+		return "", nil, false
+	}
+
+	fields := strings.Fields(text)
+	name = strings.TrimPrefix(fields[0], "/")
+
+	if at := strings.Index(name, "@"); at >= 0 {
+		if botName != "" && !strings.EqualFold(name[at+1:], botName) {
+			return "", nil, false
+		}
+		name = name[:at]
+	}
+
+	return strings.ToLower(name), fields[1:], name != ""
+}
+
+// findCommand returns the command by the name and the suffix of the name
+func findCommand(commands []Command, name string) (*Command, string) {
+	for i, command := range commands {
+		if name == command.Name {
+			return &commands[i], ""
+		}
+
+		if command.Suffix && strings.HasPrefix(name, command.Name+"_") {
+			return &commands[i], strings.TrimPrefix(name, command.Name+"_")
+		}
+	}
+
+	return nil, ""
+}
+
+// handleMessage routes the message to the command handler after the access check
+func (b *bot) handleMessage(message *tgbotapi.Message) {
+	fromID := int64(message.From.ID)
+	chatID := message.Chat.ID
+
+	log.Debug().Msgf("[telegram] received a message from %d in chat %d", fromID, chatID)
+
+	var command *Command
+	c := commandContext{Message: message, Lang: b.messageLanguage(message)}
+
+	if name, args, ok := parseCommand(message.Text, b.botName()); ok {
+		command, c.Suffix = findCommand(b.commands(), name)
+		c.Args = args
+	}
+
+	if command != nil && command.Access == commandPublic {
+		command.Handler(c)
+		return
+	}
+
+	access := b.getAccess()
+
+	grantID := chatID
+	if command != nil && command.Own {
+		grantID = fromID
+	}
+
+	grant, ok := access.resolve(grantID)
+	if !ok {
+		return
+	}
+	grant.Chat = chatID
+	c.Grant = grant
+
+	if command == nil {
+		// the reply to the notification is the receipt or the note and the tags of its statement item
+		if b.attachReceipt(c) || (!strings.HasPrefix(message.Text, "/") && b.annotate(c)) {
+			return
+		}
+
+		// the token is sent by the next message after /connect
+		if !strings.HasPrefix(message.Text, "/") && chatID == fromID && b.isConnecting(fromID) {
+			b.connectToken(message, strings.TrimSpace(message.Text))
+			return
+		}
+
+		log.Debug().Msg("[telegram] the message is unsupported")
+		return
+	}
+
+	if command.Access == commandRole && !access.can(grant, command.Name) {
+		log.Debug().Msgf("[telegram] %s is not allowed to %s", command.Name, grant.Role)
+
+		b.denyAccess(tgbotapi.Update{Message: message}, true)
+		return
+	}
+
+	command.Handler(c)
+}
+
+// botName returns the username of the bot to recognize the commands like /balance@bot
+func (b *bot) botName() string {
+	botAPI := b.getBotAPI()
+	if botAPI == nil {
+		return ""
+	}
+
+	return botAPI.Self.UserName
+}
+
+// allowedCommands returns the commands allowed to the access
+func (b *bot) allowedCommands(grant AccessConfig) []Command {
+	access := b.getAccess()
+
+	commands := []Command{}
+	for _, command := range b.commands() {
+		if command.Access != commandRole || access.can(grant, command.Name) {
+			commands = append(commands, command)
+		}
+	}
+
+	return commands
+}
+
+// registerCommands sets the commands of the telegram menu in every language, the viewer commands by default
+// and the owner commands in the private chats of the owners
+func (b *bot) registerCommands() error {
+	viewers := b.allowedCommands(AccessConfig{Role: RoleViewer})
+	owners := b.allowedCommands(AccessConfig{Role: RoleOwner})
+
+	// the empty language code is used for the users without the catalog of their language
+	codes := append([]string{""}, languages()...)
+	for _, code := range codes {
+		lang := Lang(code)
+		if code == "" {
+			lang = b.defaultLanguage()
+		}
+
+		if err := b.setMyCommands(viewers, nil, lang, code); err != nil {
+			return err
+		}
+
+		for _, id := range b.admins() {
+			if err := b.setMyCommands(owners, map[string]interface{}{"type": "chat", "chat_id": id}, lang, code); err != nil {
+				return fmt.Errorf("owner %d: %w", id, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// setMyCommands sets the commands of the telegram menu for the scope and the language code of the users
+func (b *bot) setMyCommands(commands []Command, scope map[string]interface{}, lang Lang, code string) error {
+	type botCommand struct {
+		Command     string `json:"command"`
+		Description string `json:"description"`
+	}
+
+	botCommands := []botCommand{}
+	for _, command := range commands {
+		botCommands = append(botCommands, botCommand{Command: command.Name, Description: T(lang, "cmd."+command.Name)})
+	}
+
+	data, err := json.Marshal(botCommands)
+	if err != nil {
+		return err
+	}
+
+	params := url.Values{}
+	params.Set("commands", string(data))
+
+	if scope != nil {
+		data, err := json.Marshal(scope)
+		if err != nil {
+			return err
+		}
+		params.Set("scope", string(data))
+	}
+
+	if code != "" {
+		params.Set("language_code", code)
+	}
+
+	response, err := b.getBotAPI().MakeRequest("setMyCommands", params)
+	if err != nil {
+		return err
+	}
+
+	if !response.Ok {
+		return errors.New(response.Description)
+	}
+
+	return nil
+}
+
+// cmdHelp sends the commands allowed to the user
+func (b *bot) cmdHelp(c commandContext) {
+	lines := []string{T(c.Lang, "commands")}
+	for _, command := range b.allowedCommands(c.Grant) {
+		usage := "/" + command.Name
+		if command.Args != "" {
+			usage += " " + command.Args
+		}
+
+		lines = append(lines, fmt.Sprintf("%s - %s", usage, T(c.Lang, "cmd."+command.Name)))
+	}
+
+	b.reply(c.Message, strings.Join(lines, "\n"))
+}
+
+// cmdBalance sends the balance of the client or the buttons to choose the client
+func (b *bot) cmdBalance(c commandContext) {
+	clients := b.visibleClients(c.Grant)
+	if len(clients) == 0 {
+		b.reply(c.Message, T(c.Lang, "client_not_found"))
+		return
+	}
+
+	if len(clients) > 1 {
+		msg, err := b.sendClientButtons("bc", clients, c.Message, "")
+		if err != nil {
+			log.Error().Err(err).Msg("[telegram] balance buttons error")
+			return
+		}
+
+		if _, err := b.send(msg); err != nil {
+			log.Error().Err(err).Msg("[telegram] balance send msg error")
+		}
+		return
+	}
+
+	if err := b.sendBalanceByClient(clients[0], c.Grant, c.Message); err != nil {
+		log.Error().Err(err).Msg("[telegram] balance, send msg error")
+	}
+}
+
+// cmdReport sends the buttons to choose the client, the account or the period of the report
+func (b *bot) cmdReport(c commandContext) {
+	log.Debug().Msg("[telegram] report")
+
+	// example: /report #vacation
+	tag := strings.ToLower(strings.TrimPrefix(c.Arg(0), "#"))
+
+	clients := b.visibleClients(c.Grant)
+	if len(clients) == 0 {
+		b.reply(c.Message, T(c.Lang, "client_not_found"))
+		return
+	}
+
+	if len(clients) > 1 {
+		msg, err := b.sendClientButtons("rc", clients, c.Message, tag)
+		if err != nil {
+			log.Error().Err(err).Msg("[telegram] report buttons error")
+			return
+		}
+
+		if _, err := b.send(msg); err != nil {
+			log.Error().Err(err).Msg("[telegram] report send msg error")
+		}
+		return
+	}
+
+	client := clients[0]
+
+	// the default account skips the account selection
+	if account := b.getDefaultAccount(client, c.Grant); account != nil {
+		session, err := b.newCallbackSession(client.GetID(), account.ID, tag)
+		if err != nil {
+			log.Error().Err(err).Msg("[telegram] report callback session")
+			return
+		}
+
+		editMessage := client.GetReport(account.ID).GetKeyboarButtonConfig(tgbotapi.Update{Message: c.Message}, session, c.Lang)
+
+		msg := tgbotapi.NewMessage(c.Message.Chat.ID, fmt.Sprintf(
+			"%s, %s%s\n%s",
+			client.GetName(),
+			FormatPrice(c.Lang, account.Balance),
+			GetCurrencySymbol(account.CurrencyCode),
+			editMessage.Text,
+		))
+		msg.ReplyToMessageID = c.Message.MessageID
+		msg.ReplyMarkup = editMessage.ReplyMarkup
+
+		if _, err := b.send(msg); err != nil {
+			log.Error().Err(err).Msg("[telegram] report send msg error")
+		}
+		return
+	}
+
+	tmConfig, err := b.sendAccountButtonsMessage("ra", client, *c.Message, b.accountFilter(client, c.Grant), tag)
+	if err != nil {
+		log.Error().Err(err).Msg("[telegram] report send msg error")
+		return
+	}
+
+	if _, err := b.send(tmConfig); err != nil {
+		log.Error().Err(err).Msg("[telegram] report send msg error")
+	}
+}
+
+// cmdGetWebhook sends the webhook status of the client, example: /get_webhook_1, /get_webhook_family
+func (b *bot) cmdGetWebhook(c commandContext) {
+	client, err := b.getClientByRef(c.Suffix, c.Grant)
+	if err != nil {
+		b.reply(c.Message, err.Error())
+		return
+	}
+
+	clientInfo, err := client.GetInfo()
+	if err != nil {
+		b.reply(c.Message, err.Error())
+		return
+	}
+
+	message, err := executeTemplate(b.getTemplate(webhookTemplateName, client, c.Message.Chat.ID), c.Lang, b.timezone(c.Message.Chat.ID), clientInfo)
+	if err != nil {
+		log.Error().Err(err).Msg("[telegram] get webhook, template execute error")
+		return
+	}
+
+	b.replyHTML(c.Message, message)
+}
+
+// cmdSetWebhook sets the webhook url of the client, example: /set_webhook_1 https://example.com/web_hook
+func (b *bot) cmdSetWebhook(c commandContext) {
+	if len(c.Args) != 1 {
+		b.reply(c.Message, T(c.Lang, "set_webhook_usage"))
+		return
+	}
+
+	if !IsURL(c.Arg(0)) {
+		b.reply(c.Message, T(c.Lang, "incorrect_url"))
+		return
+	}
+
+	client, err := b.getClientByRef(c.Suffix, c.Grant)
+	if err != nil {
+		b.reply(c.Message, err.Error())
+		return
+	}
+
+	response, err := client.SetWebHook(c.Arg(0))
+	if err != nil {
+		b.reply(c.Message, err.Error())
+		return
+	}
+
+	message := response.Status
+	if message == "" {
+		message = fmt.Sprintf("error: %s", response.ErrorDescription)
+	}
+
+	b.reply(c.Message, message)
+}
+
+// cmdReload reloads the configuration
+func (b *bot) cmdReload(c commandContext) {
+	message := T(c.Lang, "config_reloaded")
+	if err := b.Reload(); err != nil {
+		log.Error().Err(err).Msg("[config] reload")
+		message = T(c.Lang, "config_error", err)
+	}
+
+	b.reply(c.Message, message)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	var tests = []struct {
+		text string
+		name string
+		args int
+		ok   bool
+	}{
+		{"/balance", "balance", 0, true},
+		{"/Balance@mono_bot", "balance", 0, true},
+		{"/set_webhook_1@mono_bot https://example.com", "set_webhook_1", 1, true},
+		{"/balance@other_bot", "", 0, false},
+		{"/invite viewer family", "invite", 2, true},
+		{"balance", "", 0, false},
+		{"/", "", 0, false},
+	}
+
+	for _, test := range tests {
+		name, args, ok := parseCommand(test.text, "mono_bot")
+		if name != test.name || len(args) != test.args || ok != test.ok {
+			t.Error("For", test.text, "expected", test.name, test.args, test.ok, "got", name, len(args), ok)
+		}
+	}
+}
+
+func TestFindCommand(t *testing.T) {
+	commands := []Command{{Name: "balance"}, {Name: "get_webhook", Suffix: true}}
+
+	var tests = []struct {
+		name    string
+		command string
+		suffix  string
+	}{
+		{"balance", "balance", ""},
+		{"get_webhook", "get_webhook", ""},
+		{"get_webhook_family", "get_webhook", "family"},
+		{"balance_1", "", ""},
+		{"report", "", ""},
+	}
+
+	for _, test := range tests {
+		command, suffix := findCommand(commands, test.name)
+
+		name := ""
+		if command != nil {
+			name = command.Name
+		}
+
+		if name != test.command || suffix != test.suffix {
+			t.Error("For", test.name, "expected", test.command, test.suffix, "got", name, suffix)
+		}
+	}
+}
+
+func TestAllowedCommands(t *testing.T) {
+	b := newTestInviteBot(t)
+
+	for _, command := range b.allowedCommands(AccessConfig{Role: RoleNotifier}) {
+		if command.Access == commandRole {
+			t.Error("Expected no role commands for notifier, got ", command.Name)
+		}
+	}
+
+	if len(b.allowedCommands(AccessConfig{Role: RoleOwner})) <= len(b.allowedCommands(AccessConfig{Role: RoleViewer})) {
+		t.Error("Expected more commands for owner")
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is a configuration of the bot, it is populated from the environment variables
+// and the optional yaml file, values from the file take precedence.
+type Config struct {
+	TelegramToken  string            `yaml:"telegram_token"`
+	TelegramAdmins []int64           `yaml:"telegram_admins"`
+	TelegramChats  []int64           `yaml:"telegram_chats"`
+	Access         []AccessConfig    `yaml:"access"`
+	Roles          map[Role][]string `yaml:"roles"` // overrides of the commands allowed to the roles
+	MonoTokens     string            `yaml:"-"`
+	Clients        []ClientConfig    `yaml:"clients"`
+	StoragePath    string            `yaml:"storage_path"`
+	WebhookSecret  string            `yaml:"webhook_secret"`
+
+	PublicURL            string        `yaml:"public_url"`
+	WebhookCheckInterval time.Duration `yaml:"webhook_check_interval"`
+
+	TelegramWebhookURL    string `yaml:"telegram_webhook_url"`
+	TelegramWebhookSecret string `yaml:"telegram_webhook_secret"`
+
+	MultiTenant   bool   `yaml:"multi_tenant"`    // the users connect own monobank tokens by /connect
+	UserTokensKey string `yaml:"user_tokens_key"` // a passphrase to encrypt the tokens of the users
+
+	Language     Lang   `yaml:"language"`      // the default language of the chats
+	Timezone     string `yaml:"timezone"`      // the default timezone of the chats, example: Europe/Kiev
+	TemplatesDir string `yaml:"templates_dir"` // the template overrides, see LoadTemplates
+	ReceiptsDir  string `yaml:"receipts_dir"`  // the local copies of the receipts, they are kept only in telegram if empty
+
+	Features FeaturesConfig `yaml:"features"`
+	HTTP     HTTPConfig     `yaml:"http"`
+	MQTT     MQTTConfig     `yaml:"mqtt"`
+	Metrics  MetricsConfig  `yaml:"metrics"`
+}
+
+// ClientConfig is a configuration of the monobank client
+type ClientConfig struct {
+	Alias          string          `yaml:"alias"` // a name to identify the client in commands, example: /get_webhook_family
+	Token          string          `yaml:"token"`
+	DefaultAccount string          `yaml:"default_account"` // the account is used by /report without choosing
+	Chats          []int64         `yaml:"chats"`           // notification chats, the common chats and admins are used if empty
+	Templates      TemplatesConfig `yaml:"templates"`
+}
+
+// TemplatesConfig is a configuration of the template overrides
+type TemplatesConfig struct {
+	Statement string `yaml:"statement"`
+	Balance   string `yaml:"balance"`
+}
+
+// FeaturesConfig is a configuration to switch off the configured features
+type FeaturesConfig struct {
+	MQTT         bool `yaml:"mqtt"`
+	Metrics      bool `yaml:"metrics"`
+	WebhookCheck bool `yaml:"webhook_check"`
+}
+
+// HTTPConfig is a configuration of the http server
+type HTTPConfig struct {
+	Addr           string        `yaml:"addr"`
+	TLSCertFile    string        `yaml:"tls_cert_file"`
+	TLSKeyFile     string        `yaml:"tls_key_file"`
+	TLSSelfSigned  bool          `yaml:"tls_self_signed"` // generate a certificate for the local testing
+	ReadTimeout    time.Duration `yaml:"read_timeout"`
+	WriteTimeout   time.Duration `yaml:"write_timeout"`
+	IdleTimeout    time.Duration `yaml:"idle_timeout"`
+	TrustedProxies string        `yaml:"trusted_proxies"` // comma separated IPs or CIDRs, example: 127.0.0.1,10.0.0.0/8
+}
+
+// MQTTConfig is a configuration of the MQTT publisher
+type MQTTConfig struct {
+	Broker      string `yaml:"broker"` // example: tcp://127.0.0.1:1883
+	ClientID    string `yaml:"client_id"`
+	Username    string `yaml:"username"`
+	Password    string `yaml:"password"`
+	TopicPrefix string `yaml:"topic_prefix"`
+}
+
+// MetricsConfig is a configuration of the prometheus metrics
+type MetricsConfig struct {
+	Balances bool `yaml:"balances"` // export balances of the accounts, they are sensitive
+}
+
+// LoadConfig returns a config object populated from the environment variables, the CONFIG_FILE file
+// and the encrypted SECRETS_FILE file. The loaded secrets are redacted in the logs.
+func LoadConfig() (Config, error) {
+	config, err := NewConfigFromEnv()
+	if err != nil {
+		return config, err
+	}
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return config, err
+		}
+
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return config, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+
+	if path := os.Getenv("SECRETS_FILE"); path != "" {
+		passphrase, err := getEnvSecret("SECRETS_PASSPHRASE")
+		if err != nil {
+			return config, err
+		}
+
+		secrets, err := LoadSecrets(path, passphrase)
+		if err != nil {
+			return config, err
+		}
+
+		secrets.apply(&config)
+	}
+
+	logRedactor.Add(config.Secrets()...)
+
+	return config, config.Validate()
+}
+
+// LoadHTTPConfig returns only the http section of the configuration by the environment variables and CONFIG_FILE,
+// the secrets are not read and decrypted, it is used by the healthcheck
+func LoadHTTPConfig() (HTTPConfig, error) {
+	config := struct {
+		HTTP HTTPConfig `yaml:"http"`
+	}{HTTP: newHTTPConfigFromEnv()}
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return config.HTTP, err
+		}
+
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return config.HTTP, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+
+	return config.HTTP, nil
+}
+
+// NewConfigFromEnv returns a config object populated from the environment variables,
+// the secrets are read from the files of the <name>_FILE variables if they are set.
+func NewConfigFromEnv() (Config, error) {
+	secrets := map[string]string{}
+	for _, key := range []string{"TELEGRAM_TOKEN", "MONO_TOKENS", "WEBHOOK_SECRET", "TELEGRAM_WEBHOOK_SECRET", "MQTT_PASSWORD", "USER_TOKENS_KEY"} {
+		value, err := getEnvSecret(key)
+		if err != nil {
+			return Config{}, err
+		}
+
+		secrets[key] = value
+	}
+
+	return Config{
+		TelegramToken:  secrets["TELEGRAM_TOKEN"],
+		TelegramAdmins: parseIds(os.Getenv("TELEGRAM_ADMINS")),
+		TelegramChats:  parseIds(os.Getenv("TELEGRAM_CHATS")),
+		MonoTokens:     secrets["MONO_TOKENS"],
+		StoragePath:    getEnv("STORAGE_PATH", "data/mono_personal_tgbot.db"),
+		WebhookSecret:  secrets["WEBHOOK_SECRET"],
+
+		PublicURL:            os.Getenv("PUBLIC_URL"),
+		WebhookCheckInterval: getEnvDuration("WEBHOOK_CHECK_INTERVAL", time.Hour),
+
+		TelegramWebhookURL:    os.Getenv("TELEGRAM_WEBHOOK_URL"),
+		TelegramWebhookSecret: secrets["TELEGRAM_WEBHOOK_SECRET"],
+
+		MultiTenant:   getEnvBool("MULTI_TENANT", false),
+		UserTokensKey: secrets["USER_TOKENS_KEY"],
+
+		Language:     Lang(getEnv("LANGUAGE", string(LangUK))),
+		Timezone:     getEnv("TIMEZONE", defaultTimezone),
+		TemplatesDir: os.Getenv("TEMPLATES_DIR"),
+		ReceiptsDir:  os.Getenv("RECEIPTS_DIR"),
+
+		Features: FeaturesConfig{
+			MQTT:         true,
+			Metrics:      true,
+			WebhookCheck: true,
+		},
+
+		HTTP: newHTTPConfigFromEnv(),
+
+		MQTT: MQTTConfig{
+			Broker:      os.Getenv("MQTT_BROKER"),
+			ClientID:    getEnv("MQTT_CLIENT_ID", "mono_personal_tgbot"),
+			Username:    os.Getenv("MQTT_USERNAME"),
+			Password:    secrets["MQTT_PASSWORD"],
+			TopicPrefix: getEnv("MQTT_TOPIC_PREFIX", "mono"),
+		},
+
+		Metrics: MetricsConfig{
+			Balances: getEnvBool("METRICS_BALANCES", false),
+		},
+	}, nil
+}
+
+// newHTTPConfigFromEnv returns the http section of the configuration by the environment variables
+func newHTTPConfigFromEnv() HTTPConfig {
+	return HTTPConfig{
+		Addr:           getEnv("LISTEN_ADDR", ":8080"),
+		TLSCertFile:    os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:     os.Getenv("TLS_KEY_FILE"),
+		TLSSelfSigned:  getEnvBool("TLS_SELF_SIGNED", false),
+		ReadTimeout:    getEnvDuration("HTTP_READ_TIMEOUT", 10*time.Second),
+		WriteTimeout:   getEnvDuration("HTTP_WRITE_TIMEOUT", 10*time.Second),
+		IdleTimeout:    getEnvDuration("HTTP_IDLE_TIMEOUT", 60*time.Second),
+		TrustedProxies: os.Getenv("TRUSTED_PROXIES"),
+	}
+}
+
+// ClientConfigs returns configurations of the clients, MONO_TOKENS is used if the clients are not configured in the file
+func (c Config) ClientConfigs() []ClientConfig {
+	if len(c.Clients) > 0 {
+		return c.Clients
+	}
+
+	// the tokens file may have a token per line
+	tokens := strings.FieldsFunc(c.MonoTokens, func(r rune) bool {
+		return r == ',' || r == '\n'
+	})
+
+	clients := []ClientConfig{}
+	for _, token := range tokens {
+		if token = strings.TrimSpace(token); token != "" {
+			clients = append(clients, ClientConfig{Token: token})
+		}
+	}
+
+	return clients
+}
+
+// Secrets returns the tokens, the passwords and the secrets of the config
+func (c Config) Secrets() []string {
+	secrets := []string{c.TelegramToken, c.WebhookSecret, c.TelegramWebhookSecret, c.MQTT.Password, c.UserTokensKey}
+	for _, client := range c.ClientConfigs() {
+		secrets = append(secrets, client.Token)
+	}
+
+	return secrets
+}
+
+// Validate checks the configuration of the clients and the roles
+func (c Config) Validate() error {
+	clients := c.ClientConfigs()
+	if len(clients) == 0 && !c.MultiTenant {
+		return errors.New("config: no monobank clients")
+	}
+
+	if c.MultiTenant && c.UserTokensKey == "" {
+		return errors.New("config: the multi-tenant mode requires USER_TOKENS_KEY")
+	}
+
+	if c.Language != "" && !isLanguage(c.Language) {
+		return fmt.Errorf("config: unknown language %s, available: %s", c.Language, strings.Join(languages(), ", "))
+	}
+
+	if _, err := loadLocation(c.Timezone); err != nil {
+		return fmt.Errorf("config: timezone %s: %w", c.Timezone, err)
+	}
+
+	if _, err := newAccess(c); err != nil {
+		return err
+	}
+
+	aliases := map[string]bool{}
+	for i, client := range clients {
+		if client.Token == "" {
+			return fmt.Errorf("config: client %d, empty token", i)
+		}
+
+		if client.Alias == "" {
+			continue
+		}
+
+		if aliases[client.Alias] {
+			return fmt.Errorf("config: client %d, duplicate alias %s", i, client.Alias)
+		}
+		aliases[client.Alias] = true
+
+		if _, err := strconv.Atoi(client.Alias); err == nil || strings.ContainsAny(client.Alias, " /@") {
+			return fmt.Errorf("config: client %d, alias %s must not be a number or contain spaces, / and @", i, client.Alias)
+		}
+	}
+
+	return nil
+}
+
+// getEnv returns a value of the environment variable or the fallback value if it is empty
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvBool returns a boolean value of the environment variable or the fallback value if it is empty or incorrect
+func getEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvDuration returns a duration value of the environment variable or the fallback value if it is empty or incorrect, example: 10s
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
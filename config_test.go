@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `
+telegram_admins: [1, 2]
+clients:
+  - alias: personal
+    token: token1
+    default_account: acc1
+  - alias: family
+    token: token2
+    chats: [-100]
+features:
+  mqtt: false
+`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("TELEGRAM_TOKEN", "telegram")
+	t.Setenv("TELEGRAM_ADMINS", "3")
+	t.Setenv("MONO_TOKENS", "token3")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.TelegramToken != "telegram" {
+		t.Error("Expected telegram, got ", config.TelegramToken)
+	}
+
+	if len(config.TelegramAdmins) != 2 || config.TelegramAdmins[0] != 1 {
+		t.Error("Expected [1 2], got ", config.TelegramAdmins)
+	}
+
+	clients := config.ClientConfigs()
+	if len(clients) != 2 {
+		t.Fatal("Expected 2, got ", len(clients))
+	}
+
+	if clients[0].DefaultAccount != "acc1" {
+		t.Error("Expected acc1, got ", clients[0].DefaultAccount)
+	}
+
+	if len(clients[1].Chats) != 1 || clients[1].Chats[0] != -100 {
+		t.Error("Expected [-100], got ", clients[1].Chats)
+	}
+
+	if config.Features.MQTT || !config.Features.Metrics {
+		t.Error("Expected mqtt off and metrics on, got ", config.Features)
+	}
+}
+
+func TestConfigClientConfigsFromEnv(t *testing.T) {
+	config := Config{MonoTokens: "token1, token2,"}
+
+	clients := config.ClientConfigs()
+	if len(clients) != 2 {
+		t.Fatal("Expected 2, got ", len(clients))
+	}
+
+	if clients[1].Token != "token2" {
+		t.Error("Expected token2, got ", clients[1].Token)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	var tests = []struct {
+		clients []ClientConfig
+		valid   bool
+	}{
+		{[]ClientConfig{{Token: "t1"}, {Token: "t2"}}, true},
+		{[]ClientConfig{{Alias: "a", Token: "t1"}, {Alias: "b", Token: "t2"}}, true},
+		{[]ClientConfig{}, false},
+		{[]ClientConfig{{Alias: "a"}}, false},
+		{[]ClientConfig{{Alias: "a", Token: "t1"}, {Alias: "a", Token: "t2"}}, false},
+		{[]ClientConfig{{Alias: "1", Token: "t1"}}, false},
+		{[]ClientConfig{{Alias: "a b", Token: "t1"}}, false},
+		{[]ClientConfig{{Alias: "a@b", Token: "t1"}}, false},
+	}
+
+	for _, test := range tests {
+		err := Config{Clients: test.clients}.Validate()
+		if (err == nil) != test.valid {
+			t.Error("clients", test.clients, "expected valid", test.valid, "got", err)
+		}
+	}
+}
+
+func TestLoadHTTPConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `
+telegram_admins: [1]
+http:
+  tls_self_signed: true
+`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the secrets are not loaded, the missing secrets file is not an error
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("SECRETS_FILE", filepath.Join(t.TempDir(), "secrets.enc"))
+	t.Setenv("TELEGRAM_TOKEN_FILE", filepath.Join(t.TempDir(), "token"))
+	t.Setenv("LISTEN_ADDR", ":9090")
+
+	config, err := LoadHTTPConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Addr != ":9090" || !config.TLSSelfSigned {
+		t.Error("Expected :9090 with the self signed certificate, got ", config)
+	}
+}
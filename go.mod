@@ -3,9 +3,29 @@ module github.com/vkopitsa/mono_personal_tgbot
 go 1.18
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.4.2
 	github.com/go-telegram-bot-api/telegram-bot-api v4.6.4+incompatible
+	github.com/prometheus/client_golang v1.13.0
 	github.com/rs/zerolog v1.27.0
-	golang.org/x/time v0.0.0-20190308202827-9d24e82272b4
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/crypto v0.0.0-20220525230936-793ad666bf5e
+	golang.org/x/time v0.0.0-20191024005414-555d28b269f0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/gorilla/websocket v1.4.2 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
+	github.com/prometheus/client_model v0.2.0 // indirect
+	github.com/prometheus/common v0.37.0 // indirect
+	github.com/prometheus/procfs v0.8.0 // indirect
+	golang.org/x/net v0.0.0-20220225172249-27dd8689420f // indirect
+	golang.org/x/sync v0.0.0-20220601150217-0de741cfad7f // indirect
+	google.golang.org/protobuf v1.28.1 // indirect
 )
 
 require (
@@ -15,5 +35,5 @@ require (
 	github.com/snabb/isoweek v1.0.1
 	github.com/technoweenie/multipartstreamer v1.0.1 // indirect
 	golang.org/x/exp v0.0.0-20220713135740-79cabaa25d75
-	golang.org/x/sys v0.0.0-20211019181941-9d821ace8654 // indirect
+	golang.org/x/sys v0.0.0-20220520151302-bc2c85ada10a // indirect
 )
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	statusStarting = "starting"
+	statusUp       = "up"
+	statusDown     = "down"
+)
+
+// ComponentStatus is a status of the bot subsystem
+type ComponentStatus struct {
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	LastSuccess time.Time `json:"lastSuccess,omitempty"`
+}
+
+// HealthReport is a response of the health endpoints
+type HealthReport struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+type health struct {
+	mu         sync.RWMutex
+	components map[string]ComponentStatus
+
+	// critical components make the liveness probe fail when they are down
+	critical map[string]bool
+}
+
+func newHealth(critical ...string) *health {
+	h := &health{
+		components: map[string]ComponentStatus{},
+		critical:   map[string]bool{},
+	}
+
+	for _, component := range critical {
+		h.critical[component] = true
+		h.components[component] = ComponentStatus{Status: statusStarting, UpdatedAt: time.Now()}
+	}
+
+	return h
+}
+
+// Up marks the component as working
+func (h *health) Up(component string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	h.components[component] = ComponentStatus{
+		Status:      statusUp,
+		UpdatedAt:   now,
+		LastSuccess: now,
+	}
+}
+
+// Down marks the component as failed
+func (h *health) Down(component string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := ComponentStatus{
+		Status:      statusDown,
+		UpdatedAt:   time.Now(),
+		LastSuccess: h.components[component].LastSuccess,
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	h.components[component] = status
+}
+
+// IsUp checks that the component is working
+func (h *health) IsUp(component string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.components[component].Status == statusUp
+}
+
+// Get returns statuses of all components
+func (h *health) Get() map[string]ComponentStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	components := make(map[string]ComponentStatus, len(h.components))
+	for name, status := range h.components {
+		components[name] = status
+	}
+
+	return components
+}
+
+// Liveness returns a report where only critical components are able to fail the probe
+func (h *health) Liveness(extra map[string]ComponentStatus) HealthReport {
+	report := h.report(extra)
+
+	report.Status = statusUp
+	for name, status := range report.Components {
+		if h.critical[name] && status.Status == statusDown {
+			report.Status = statusDown
+		}
+	}
+
+	return report
+}
+
+// Readiness returns a report where the critical components have to be up, the other components are only listed,
+// example: a failed monobank api call of a client does not stop the webhooks of all clients
+func (h *health) Readiness(extra map[string]ComponentStatus) HealthReport {
+	report := h.report(extra)
+
+	report.Status = statusUp
+	for name, status := range report.Components {
+		if h.critical[name] && status.Status != statusUp {
+			report.Status = statusDown
+		}
+	}
+
+	return report
+}
+
+func (h *health) report(extra map[string]ComponentStatus) HealthReport {
+	components := h.Get()
+	for name, status := range extra {
+		components[name] = status
+	}
+
+	return HealthReport{Components: components}
+}
+
+// writeHealthReport writes the report as json, 503 status code is used if the report is down
+func writeHealthReport(w http.ResponseWriter, report HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if report.Status != statusUp {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
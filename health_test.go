@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHealthLiveness(t *testing.T) {
+	h := newHealth("telegram", "processing")
+	h.Up("telegram")
+	h.Up("processing")
+
+	clients := map[string]ComponentStatus{
+		"client/1": {Status: statusDown, Error: "monobank api: Unknown 'X-Token'"},
+	}
+
+	if report := h.Liveness(clients); report.Status != statusUp {
+		t.Error("Expected up, got ", report.Status)
+	}
+
+	h.Down("telegram", errors.New("updates channel closed"))
+
+	report := h.Liveness(nil)
+	if report.Status != statusDown {
+		t.Error("Expected down, got ", report.Status)
+	}
+	if report.Components["telegram"].Error != "updates channel closed" {
+		t.Error("Expected error, got ", report.Components["telegram"].Error)
+	}
+	if report.Components["telegram"].LastSuccess.IsZero() {
+		t.Error("Expected the last success to be kept")
+	}
+}
+
+func TestHealthReadiness(t *testing.T) {
+	h := newHealth("telegram", "processing")
+	h.Up("telegram")
+
+	if report := h.Readiness(nil); report.Status != statusDown {
+		t.Error("Expected down while processing is starting, got ", report.Status)
+	}
+
+	h.Up("processing")
+
+	if report := h.Readiness(nil); report.Status != statusUp {
+		t.Error("Expected up, got ", report.Status)
+	}
+
+	clients := map[string]ComponentStatus{
+		"client/1": {Status: statusDown},
+	}
+
+	// the clients are listed, a failed monobank api call does not fail the probe
+	report := h.Readiness(clients)
+	if report.Status != statusUp || report.Components["client/1"].Status != statusDown {
+		t.Error("Expected up with the failed client, got ", report)
+	}
+
+	h.Down("webhook_check", errors.New("monobank api: Too many requests"))
+	if report := h.Readiness(nil); report.Status != statusUp {
+		t.Error("Expected up with the failed webhook check, got ", report.Status)
+	}
+}
+
+func TestCheckStorage(t *testing.T) {
+	b := newTestInviteBot(t)
+	b.health = newHealth("storage")
+
+	b.checkStorage()
+	if !b.health.IsUp("storage") {
+		t.Error("Expected the storage up, got ", b.health.Get()["storage"])
+	}
+
+	b.storage.Close()
+	b.checkStorage()
+	if b.health.IsUp("storage") {
+		t.Error("Expected the closed storage down")
+	}
+}
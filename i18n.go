@@ -0,0 +1,514 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/rs/zerolog/log"
+)
+
+// Lang is a language code of the catalog, example: uk
+type Lang string
+
+const (
+	LangUK Lang = "uk"
+	LangEN Lang = "en"
+
+	// the language of the texts missing in other catalogs
+	fallbackLang = LangUK
+
+	languagesBucket = "languages"
+)
+
+// catalogs are the texts of the bot by the language, a new language is a new catalog
+var catalogs = map[Lang]map[string]string{
+	LangUK: {
+		"language.name": "Українська",
+
+		"number.decimal": ",",
+		"number.group":   "\u00a0",
+
+		"access_denied":     "Доступ заборонено",
+		"button_outdated":   "Кнопка застаріла, надішліть команду ще раз",
+		"error":             "Помилка :(",
+		"choose_client":     "Виберіть клієнта:",
+		"choose_account":    "Виберіть рахунок:",
+		"choose_period":     "Виберіть період",
+		"client_not_found":  "Клієнта не знайдено",
+		"commands":          "Команди:",
+		"config_reloaded":   "Конфігурацію перезавантажено",
+		"config_error":      "Помилка перезавантаження конфігурації: %s",
+		"set_webhook_usage": "Використання: /set_webhook[_n] <url>",
+		"incorrect_url":     "Некоректний url",
+		"webhook_set":       "%s: вебхук встановлено, %s",
+		"client_error":      "%s: %s",
+
+		"unknown_role":     "Невідома роль %s, доступні: owner, viewer, notifier",
+		"invite_created":   "Код запрошення, роль %s, дійсний до %s:\n/start %s",
+		"invite_usage":     "Використання: /invite <роль> <клієнти через кому або *> [рахунки через кому], приклад: /invite viewer family",
+		"invite_required":  "Для доступу потрібен код запрошення: /start <code>",
+		"invite_not_found": "Код запрошення не знайдено або він прострочений",
+		"access_granted":   "Доступ надано, роль %s",
+		"user_granted":     "Користувач %s (%d) отримав роль %s",
+		"no_invited_users": "Немає користувачів, доданих за запрошеннями",
+		"invited_users":    "Користувачі, додані за запрошеннями:",
+		"access_revoked":   "Доступ скасовано",
+
+		"connect_private":   "Підключення токена доступне лише в приватному чаті з ботом",
+		"connect_token":     "Надішліть токен monobank (https://api.monobank.ua/) наступним повідомленням",
+		"connect_error":     "Помилка підключення: %s",
+		"connected":         "Підключено: %s. Дані бачите лише ви, /share в груповому чаті відкриває їх чату",
+		"disconnected":      "Токен видалено",
+		"incorrect_chat_id": "Некоректний id чату",
+		"share_chat":        "Вкажіть id чату або надішліть команду в груповому чаті",
+		"share_not_member":  "Чат %d не знайдено або ви не є його учасником, бот має бути доданий до чату",
+		"shared":            "Дані відкрито чату %d",
+		"unshared":          "Дані закрито для чату %d",
+
+		"language_current": "Мова: %s, доступні: %s",
+		"language_set":     "Мову змінено: %s",
+		"language_unknown": "Невідома мова %s, доступні: %s",
+
+		"timezone_current": "Часовий пояс: %s",
+		"timezone_set":     "Часовий пояс змінено: %s, зараз %s",
+		"timezone_unknown": "Невідомий часовий пояс %s, приклад: /timezone Europe/Kiev",
+
+		"annotation_saved": "Нотатку збережено, теги: %s",
+
+		"receipt_saved":              "Чек збережено, чеків операції: %d",
+		"receipt_saved_without_copy": "Чек збережено без локальної копії, чеків операції: %d",
+		"receipts_usage":             "Використання: /receipts [рррр-мм]",
+		"receipts_not_found":         "Немає чеків за %s",
+		"receipts_too_large":         "Чеки за місяць більші за 50 МБ, архів не надіслано",
+		"receipts_busy":              "Архіви чеків уже готуються, спробуйте пізніше",
+
+		"rules":          "Правила категорій, перше збігле правило задає категорію:",
+		"rules_empty":    "Правил категорій немає, приклад: /rule groceries сільпо",
+		"rule_usage":     "Використання: /rule <категорія> [текст опису] [mcc:код] [iban:рахунок] [client:клієнт], приклад: /rule rent mcc:4829 iban:UA213223130000026007233566001",
+		"rule_added":     "Правило %d додано, категорія: %s, клієнт: %s",
+		"rule_deleted":   "Правило видалено",
+		"rule_not_found": "Правило не знайдено",
+		"search_usage":   "Використання: /search <текст> [amount>500] [mcc:5411] [from:2026-01-01] [to:2026-01-31]",
+		"search_found":   "Знайдено: %d",
+
+		"spent":           "Витрачено",
+		"income":          "Надходження",
+		"cashback":        "Кешбек",
+		"comment":         "Коментар",
+		"balance":         "Баланс",
+		"webhook":         "Вебхук",
+		"webhook_missing": "Відсутній",
+		"back":            "« Назад",
+		"category_change": "🏷 Категорія",
+		"category_auto":   "За MCC",
+
+		"detail.time":             "Час",
+		"detail.category":         "Категорія",
+		"detail.original_mcc":     "Початковий MCC",
+		"detail.operation_amount": "Сума операції",
+		"detail.commission":       "Комісія",
+		"detail.status":           "Статус",
+		"detail.hold":             "Очікує",
+		"detail.completed":        "Проведено",
+
+		"category.groceries":   "Продукти",
+		"category.restaurants": "Кафе та ресторани",
+		"category.clothes":     "Одяг",
+		"category.sport":       "Спорт",
+		"category.cash":        "Готівка",
+		"category.mobile":      "Мобільний зв'язок",
+		"category.transfers":   "Перекази",
+		"category.transport":   "Транспорт",
+		"category.fuel":        "Пальне",
+		"category.pharmacy":    "Аптеки",
+		"category.beauty":      "Краса",
+		"category.household":   "Дім",
+		"category.services":    "Послуги",
+		"category.other":       "Інше",
+
+		"cmd.start":       "Початок роботи, прийняти запрошення",
+		"cmd.help":        "Список команд",
+		"cmd.language":    "Мова бота в цьому чаті",
+		"cmd.timezone":    "Часовий пояс цього чату",
+		"cmd.balance":     "Баланс рахунків",
+		"cmd.report":      "Звіт за період",
+		"cmd.receipts":    "Архів чеків за місяць",
+		"cmd.search":      "Пошук операцій",
+		"cmd.rules":       "Правила категорій",
+		"cmd.rule":        "Додати правило категорії",
+		"cmd.delete_rule": "Видалити правило категорії",
+		"cmd.get_webhook": "Стан вебхука monobank клієнта за номером або псевдонімом",
+		"cmd.set_webhook": "Встановити вебхук monobank клієнта",
+		"cmd.reload":      "Перезавантажити конфігурацію",
+		"cmd.invite":      "Створити запрошення",
+		"cmd.revoke":      "Скасувати доступ або запрошення",
+		"cmd.connect":     "Підключити свій токен monobank",
+		"cmd.disconnect":  "Видалити свій токен monobank",
+		"cmd.share":       "Відкрити свої дані чату",
+		"cmd.unshare":     "Закрити свої дані для чату",
+
+		"period.Today":      "Сьогодні",
+		"period.This week":  "Цей тиждень",
+		"period.Last week":  "Минулий тиждень",
+		"period.This month": "Цей місяць",
+		"period.Last month": "Минулий місяць",
+
+		"month.1":  "Січень",
+		"month.2":  "Лютий",
+		"month.3":  "Березень",
+		"month.4":  "Квітень",
+		"month.5":  "Травень",
+		"month.6":  "Червень",
+		"month.7":  "Липень",
+		"month.8":  "Серпень",
+		"month.9":  "Вересень",
+		"month.10": "Жовтень",
+		"month.11": "Листопад",
+		"month.12": "Грудень",
+
+		"month_of.1":  "січня",
+		"month_of.2":  "лютого",
+		"month_of.3":  "березня",
+		"month_of.4":  "квітня",
+		"month_of.5":  "травня",
+		"month_of.6":  "червня",
+		"month_of.7":  "липня",
+		"month_of.8":  "серпня",
+		"month_of.9":  "вересня",
+		"month_of.10": "жовтня",
+		"month_of.11": "листопада",
+		"month_of.12": "грудня",
+
+		"relative.now":     "щойно",
+		"relative.minutes": "%d хв тому",
+		"relative.hours":   "%d год тому",
+	},
+	LangEN: {
+		"language.name": "English",
+
+		"number.decimal": ".",
+		"number.group":   ",",
+
+		"access_denied":     "Access denied",
+		"button_outdated":   "The button is outdated, send the command again",
+		"error":             "Error :(",
+		"choose_client":     "Choose the client:",
+		"choose_account":    "Choose the account:",
+		"choose_period":     "Choose the period",
+		"client_not_found":  "Client not found",
+		"commands":          "Commands:",
+		"config_reloaded":   "The configuration is reloaded",
+		"config_error":      "Configuration reload error: %s",
+		"set_webhook_usage": "Usage: /set_webhook[_n] <url>",
+		"incorrect_url":     "Incorrect url",
+		"webhook_set":       "%s: webhook is set, %s",
+		"client_error":      "%s: %s",
+
+		"unknown_role":     "Unknown role %s, available: owner, viewer, notifier",
+		"invite_created":   "Invite code, role %s, valid until %s:\n/start %s",
+		"invite_usage":     "Usage: /invite <role> <clients separated by commas or *> [accounts separated by commas], example: /invite viewer family",
+		"invite_required":  "The access requires an invite code: /start <code>",
+		"invite_not_found": "The invite code is not found or expired",
+		"access_granted":   "Access granted, role %s",
+		"user_granted":     "User %s (%d) got role %s",
+		"no_invited_users": "No users added by invites",
+		"invited_users":    "Users added by invites:",
+		"access_revoked":   "Access revoked",
+
+		"connect_private":   "The token can be connected only in the private chat with the bot",
+		"connect_token":     "Send the monobank token (https://api.monobank.ua/) in the next message",
+		"connect_error":     "Connection error: %s",
+		"connected":         "Connected: %s. Only you see the data, /share in a group chat opens it to the chat",
+		"disconnected":      "The token is deleted",
+		"incorrect_chat_id": "Incorrect chat id",
+		"share_chat":        "Set the chat id or send the command in a group chat",
+		"share_not_member":  "Chat %d is not found or you are not its member, the bot has to be added to the chat",
+		"shared":            "The data is shared with chat %d",
+		"unshared":          "The data is not shared with chat %d anymore",
+
+		"language_current": "Language: %s, available: %s",
+		"language_set":     "Language changed: %s",
+		"language_unknown": "Unknown language %s, available: %s",
+
+		"timezone_current": "Timezone: %s",
+		"timezone_set":     "Timezone changed: %s, now %s",
+		"timezone_unknown": "Unknown timezone %s, example: /timezone Europe/Kiev",
+
+		"annotation_saved": "The note is saved, tags: %s",
+
+		"receipt_saved":              "The receipt is saved, receipts of the transaction: %d",
+		"receipt_saved_without_copy": "The receipt is saved without the local copy, receipts of the transaction: %d",
+		"receipts_usage":             "Usage: /receipts [yyyy-mm]",
+		"receipts_not_found":         "No receipts for %s",
+		"receipts_too_large":         "The receipts of the month are larger than 50 MB, the archive is not sent",
+		"receipts_busy":              "The receipts archives are being prepared, try again later",
+
+		"rules":          "The category rules, the first matched rule sets the category:",
+		"rules_empty":    "There are no category rules, example: /rule groceries silpo",
+		"rule_usage":     "Usage: /rule <category> [description text] [mcc:code] [iban:account] [client:client], example: /rule rent mcc:4829 iban:UA213223130000026007233566001",
+		"rule_added":     "The rule %d is added, category: %s, client: %s",
+		"rule_deleted":   "The rule is deleted",
+		"rule_not_found": "The rule is not found",
+		"search_usage":   "Usage: /search <text> [amount>500] [mcc:5411] [from:2026-01-01] [to:2026-01-31]",
+		"search_found":   "Found: %d",
+
+		"spent":           "Spent",
+		"income":          "Income",
+		"cashback":        "Cashback",
+		"comment":         "Comment",
+		"balance":         "Balance",
+		"webhook":         "Webhook",
+		"webhook_missing": "Not set",
+		"back":            "« Back",
+		"category_change": "🏷 Category",
+		"category_auto":   "By MCC",
+
+		"detail.time":             "Time",
+		"detail.category":         "Category",
+		"detail.original_mcc":     "Original MCC",
+		"detail.operation_amount": "Operation amount",
+		"detail.commission":       "Commission",
+		"detail.status":           "Status",
+		"detail.hold":             "Pending",
+		"detail.completed":        "Completed",
+
+		"category.groceries":   "Groceries",
+		"category.restaurants": "Cafes and restaurants",
+		"category.clothes":     "Clothes",
+		"category.sport":       "Sport",
+		"category.cash":        "Cash",
+		"category.mobile":      "Mobile",
+		"category.transfers":   "Transfers",
+		"category.transport":   "Transport",
+		"category.fuel":        "Fuel",
+		"category.pharmacy":    "Pharmacy",
+		"category.beauty":      "Beauty",
+		"category.household":   "Household",
+		"category.services":    "Services",
+		"category.other":       "Other",
+
+		"cmd.start":       "Start, accept the invite",
+		"cmd.help":        "List of commands",
+		"cmd.language":    "Bot language in this chat",
+		"cmd.timezone":    "Timezone of this chat",
+		"cmd.balance":     "Balance of the accounts",
+		"cmd.report":      "Report for the period",
+		"cmd.receipts":    "Receipts of the month as a zip archive",
+		"cmd.search":      "Search the transactions",
+		"cmd.rules":       "The category rules",
+		"cmd.rule":        "Add a category rule",
+		"cmd.delete_rule": "Delete a category rule",
+		"cmd.get_webhook": "Monobank webhook status of the client by number or alias",
+		"cmd.set_webhook": "Set the monobank webhook of the client",
+		"cmd.reload":      "Reload the configuration",
+		"cmd.invite":      "Create an invite",
+		"cmd.revoke":      "Revoke the access or the invite",
+		"cmd.connect":     "Connect your monobank token",
+		"cmd.disconnect":  "Delete your monobank token",
+		"cmd.share":       "Share your data with the chat",
+		"cmd.unshare":     "Stop sharing your data with the chat",
+
+		"period.Today":      "Today",
+		"period.This week":  "This week",
+		"period.Last week":  "Last week",
+		"period.This month": "This month",
+		"period.Last month": "Last month",
+
+		"month.1":  "January",
+		"month.2":  "February",
+		"month.3":  "March",
+		"month.4":  "April",
+		"month.5":  "May",
+		"month.6":  "June",
+		"month.7":  "July",
+		"month.8":  "August",
+		"month.9":  "September",
+		"month.10": "October",
+		"month.11": "November",
+		"month.12": "December",
+
+		"month_of.1":  "January",
+		"month_of.2":  "February",
+		"month_of.3":  "March",
+		"month_of.4":  "April",
+		"month_of.5":  "May",
+		"month_of.6":  "June",
+		"month_of.7":  "July",
+		"month_of.8":  "August",
+		"month_of.9":  "September",
+		"month_of.10": "October",
+		"month_of.11": "November",
+		"month_of.12": "December",
+
+		"relative.now":     "just now",
+		"relative.minutes": "%d min ago",
+		"relative.hours":   "%d h ago",
+	},
+}
+
+// T returns the text of the catalog formatted with the arguments, the fallback catalog is used
+// for missing texts and the key for unknown ones
+func T(lang Lang, key string, args ...interface{}) string {
+	text, ok := catalogs[lang][key]
+	if !ok {
+		text, ok = catalogs[fallbackLang][key]
+	}
+	if !ok {
+		text = key
+	}
+
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+
+	return text
+}
+
+// Text is a text of the catalog translated for every recipient
+type Text struct {
+	Key  string
+	Args []interface{}
+}
+
+// NewText returns the text of the catalog with the arguments
+func NewText(key string, args ...interface{}) Text {
+	return Text{Key: key, Args: args}
+}
+
+// In returns the text in the language
+func (t Text) In(lang Lang) string {
+	return T(lang, t.Key, t.Args...)
+}
+
+// isLanguage checks the catalog of the language exists
+func isLanguage(lang Lang) bool {
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// languages returns the languages of the catalogs
+func languages() []string {
+	langs := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		langs = append(langs, string(lang))
+	}
+	sort.Strings(langs)
+
+	return langs
+}
+
+// FormatPrice formats the price in cents with the separators of the language, example: 1 234,56
+func FormatPrice(lang Lang, price int) string {
+	sign := ""
+	if price < 0 {
+		sign = "-"
+		price = -price
+	}
+
+	digits := strconv.Itoa(price / 100)
+
+	groups := []string{}
+	for len(digits) > 3 {
+		groups = append([]string{digits[len(digits)-3:]}, groups...)
+		digits = digits[:len(digits)-3]
+	}
+	groups = append([]string{digits}, groups...)
+
+	result := sign + strings.Join(groups, T(lang, "number.group"))
+	if price%100 != 0 {
+		result += fmt.Sprintf("%s%02d", T(lang, "number.decimal"), price%100)
+	}
+
+	return result
+}
+
+// periodLabel returns the name of the report period in the language
+func periodLabel(lang Lang, period string) string {
+	if month, ok := reportCommant[period]; ok {
+		if _, err := strconv.Atoi(month); err == nil {
+			return T(lang, "month."+month)
+		}
+	}
+
+	return T(lang, "period."+period)
+}
+
+// language returns the language of the chat, the default one if it is not set
+func (b *bot) language(chatID int64) Lang {
+	var lang Lang
+	if ok, err := b.storage.Get(languagesBucket, strconv.FormatInt(chatID, 10), &lang); err != nil {
+		log.Error().Err(err).Msg("[i18n] get language")
+	} else if ok && isLanguage(lang) {
+		return lang
+	}
+
+	return b.defaultLanguage()
+}
+
+// messageLanguage returns the language of the chat of the message, the language of the telegram app
+// is used in the private chat without the chosen one
+func (b *bot) messageLanguage(message *tgbotapi.Message) Lang {
+	var lang Lang
+	if ok, _ := b.storage.Get(languagesBucket, strconv.FormatInt(message.Chat.ID, 10), &lang); ok && isLanguage(lang) {
+		return lang
+	}
+
+	// the replies of the bot get the language of the user message
+	if message.From != nil && message.From.IsBot && message.ReplyToMessage != nil {
+		message = message.ReplyToMessage
+	}
+
+	if message.From != nil && message.Chat.ID == int64(message.From.ID) {
+		// example: en-US
+		code := Lang(strings.ToLower(strings.SplitN(message.From.LanguageCode, "-", 2)[0]))
+		if isLanguage(code) {
+			return code
+		}
+	}
+
+	return b.defaultLanguage()
+}
+
+// setLanguage saves the language of the chat
+func (b *bot) setLanguage(chatID int64, lang Lang) error {
+	return b.storage.Put(languagesBucket, strconv.FormatInt(chatID, 10), lang)
+}
+
+func (b *bot) defaultLanguage() Lang {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.lang == "" {
+		return fallbackLang
+	}
+
+	return b.lang
+}
+
+// cmdLanguage handles /language [code], the current and available languages are sent without the code
+func (b *bot) cmdLanguage(c commandContext) {
+	lang := b.messageLanguage(c.Message)
+	available := strings.Join(languages(), ", ")
+
+	code := Lang(strings.ToLower(c.Arg(0)))
+	if code == "" {
+		b.reply(c.Message, T(lang, "language_current", lang, available))
+		return
+	}
+
+	if !isLanguage(code) {
+		b.reply(c.Message, T(lang, "language_unknown", code, available))
+		return
+	}
+
+	if err := b.setLanguage(c.Message.Chat.ID, code); err != nil {
+		log.Error().Err(err).Msg("[i18n] set language")
+		b.reply(c.Message, err.Error())
+		return
+	}
+
+	b.reply(c.Message, T(code, "language_set", T(code, "language.name")))
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestT(t *testing.T) {
+	var tests = []struct {
+		lang     Lang
+		key      string
+		args     []interface{}
+		expected string
+	}{
+		{LangUK, "balance", nil, "Баланс"},
+		{LangEN, "balance", nil, "Balance"},
+		{LangEN, "shared", []interface{}{-100}, "The data is shared with chat -100"},
+		{"de", "balance", nil, "Баланс"},
+		{LangEN, "unknown", nil, "unknown"},
+	}
+
+	for _, test := range tests {
+		if text := T(test.lang, test.key, test.args...); text != test.expected {
+			t.Error("Expected", test.expected, "got", text)
+		}
+	}
+}
+
+func TestCatalogsComplete(t *testing.T) {
+	for lang, catalog := range catalogs {
+		for key := range catalogs[fallbackLang] {
+			if _, ok := catalog[key]; !ok {
+				t.Error(lang, "does not have", key)
+			}
+		}
+	}
+}
+
+func TestFormatPrice(t *testing.T) {
+	var tests = []struct {
+		lang     Lang
+		price    int
+		expected string
+	}{
+		{LangEN, 0, "0"},
+		{LangEN, 1250, "12.50"},
+		{LangEN, -5, "-0.05"},
+		{LangEN, 123456700, "1,234,567"},
+		{LangUK, 123456789, "1\u00a0234\u00a0567,89"},
+		{LangUK, -100000, "-1\u00a0000"},
+	}
+
+	for _, test := range tests {
+		if price := FormatPrice(test.lang, test.price); price != test.expected {
+			t.Error("Expected", test.expected, "got", price)
+		}
+	}
+}
+
+func TestPeriodLabel(t *testing.T) {
+	if label := periodLabel(LangUK, "October"); label != "Жовтень" {
+		t.Error("Expected Жовтень, got ", label)
+	}
+
+	if label := periodLabel(LangEN, "Last week"); label != "Last week" {
+		t.Error("Expected Last week, got ", label)
+	}
+}
+
+func TestExecuteTemplate(t *testing.T) {
+	tmpl, err := GetTempate(balanceTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := ClientInfo{Name: "Name", Accounts: []Account{{Type: "black", Balance: 123456, CurrencyCode: 980}}}
+
+	// the template is executed in every language
+	for lang, expected := range map[Lang]string{
+		LangEN: "<b>Name</b>\n\n- black\nBalance: <code>1,234.56₴</code>\n",
+		LangUK: "<b>Name</b>\n\n- black\nБаланс: <code>1\u00a0234,56₴</code>\n",
+	} {
+		message, err := executeTemplate(tmpl, lang, nil, info)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if message != expected {
+			t.Errorf("Expected %q, got %q", expected, message)
+		}
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	b := newTestInviteBot(t)
+	b.lang = LangUK
+
+	message := &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 2},
+		From: &tgbotapi.User{ID: 2, LanguageCode: "en-US"},
+	}
+
+	if lang := b.messageLanguage(message); lang != LangEN {
+		t.Error("Expected en, got ", lang)
+	}
+
+	if lang := b.language(2); lang != LangUK {
+		t.Error("Expected uk, got ", lang)
+	}
+
+	if err := b.setLanguage(-10, LangEN); err != nil {
+		t.Fatal(err)
+	}
+
+	// the reply of the bot in the group chat
+	reply := &tgbotapi.Message{
+		Chat:           &tgbotapi.Chat{ID: -10},
+		From:           &tgbotapi.User{ID: 99, IsBot: true},
+		ReplyToMessage: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: -10}, From: &tgbotapi.User{ID: 2}},
+	}
+
+	if lang := b.messageLanguage(reply); lang != LangEN {
+		t.Error("Expected en, got ", lang)
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	invitesBucket = "invites"
+	accessBucket  = "access"
+
+	inviteTTL      = 24 * time.Hour
+	inviteCodeSize = 8
+
+	// allClients is the argument of /invite to grant all clients
+	allClients = "*"
+)
+
+var (
+	errInviteNotFound = errors.New("invite code does not found or expired")
+	errGrantNotFound  = errors.New("user does not found")
+)
+
+// Invite is a single-use code to get the role
+type Invite struct {
+	Code      string       `json:"code"`
+	Access    AccessConfig `json:"access"`
+	CreatedBy int64        `json:"createdBy"`
+	ExpiresAt time.Time    `json:"expiresAt"`
+}
+
+// loadAccess returns the access by the configuration with the roles granted by the invites
+func (b *bot) loadAccess(config Config) (*access, error) {
+	access, err := newAccess(config)
+	if err != nil {
+		return nil, err
+	}
+
+	grants, err := b.storedGrants()
+	if err != nil {
+		return nil, err
+	}
+
+	return access.withGrants(grants), nil
+}
+
+// storedGrants returns the roles granted by the invites
+func (b *bot) storedGrants() ([]AccessConfig, error) {
+	grants := []AccessConfig{}
+	err := b.storage.ForEach(accessBucket, func(key string, value []byte) error {
+		var grant AccessConfig
+		if err := json.Unmarshal(value, &grant); err != nil {
+			return err
+		}
+
+		grants = append(grants, grant)
+		return nil
+	})
+
+	return grants, err
+}
+
+// refreshGrants applies the roles granted by the invites to the current access
+func (b *bot) refreshGrants() error {
+	grants, err := b.storedGrants()
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.access = b.access.withGrants(grants)
+	b.mu.Unlock()
+
+	return nil
+}
+
+// createInvite saves a new invite code for the role
+func (b *bot) createInvite(grant AccessConfig, createdBy int64) (Invite, error) {
+	code := make([]byte, inviteCodeSize)
+	if _, err := rand.Read(code); err != nil {
+		return Invite{}, err
+	}
+
+	invite := Invite{
+		Code:      hex.EncodeToString(code),
+		Access:    grant,
+		CreatedBy: createdBy,
+		ExpiresAt: time.Now().Add(inviteTTL),
+	}
+
+	return invite, b.storage.Put(invitesBucket, invite.Code, invite)
+}
+
+// acceptInvite grants the role of the invite to the user, the invite is deleted
+func (b *bot) acceptInvite(code string, userID int64) (AccessConfig, error) {
+	var grant AccessConfig
+
+	err := b.storage.Update(func(tx StorageTx) error {
+		var invite Invite
+		ok, err := tx.Get(invitesBucket, code, &invite)
+		if err != nil {
+			return err
+		}
+
+		// the expired invites are removed by pruneInvites
+		if !ok || time.Now().After(invite.ExpiresAt) {
+			return errInviteNotFound
+		}
+
+		if err := tx.Delete(invitesBucket, code); err != nil {
+			return err
+		}
+
+		grant = invite.Access
+		grant.ID = userID
+
+		return tx.Put(accessBucket, strconv.FormatInt(userID, 10), grant)
+	})
+	if err != nil {
+		return grant, err
+	}
+
+	return grant, b.refreshGrants()
+}
+
+// revoke deletes the role granted to the user or the invite code
+func (b *bot) revoke(ref string) error {
+	bucket := invitesBucket
+	if _, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		bucket = accessBucket
+	}
+
+	err := b.storage.Update(func(tx StorageTx) error {
+		ok, err := tx.Get(bucket, ref, &struct{}{})
+		if err != nil {
+			return err
+		}
+
+		if !ok && bucket == accessBucket {
+			return errGrantNotFound
+		} else if !ok {
+			return errInviteNotFound
+		}
+
+		return tx.Delete(bucket, ref)
+	})
+	if err != nil {
+		return err
+	}
+
+	return b.refreshGrants()
+}
+
+// pruneInvites removes the expired invites
+func (b *bot) pruneInvites(now time.Time) error {
+	return b.storage.Update(func(tx StorageTx) error {
+		expired := []string{}
+		err := tx.ForEach(invitesBucket, func(key string, value []byte) error {
+			var invite Invite
+			if err := json.Unmarshal(value, &invite); err != nil || now.After(invite.ExpiresAt) {
+				expired = append(expired, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, key := range expired {
+			if err := tx.Delete(invitesBucket, key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// parseInviteGrant parses the arguments of /invite, the clients are required to grant the narrowest scope by default,
+// * grants all clients, example: viewer family acc1,acc2
+func parseInviteGrant(args []string) (AccessConfig, error) {
+	if len(args) < 2 || args[1] == "" {
+		return AccessConfig{}, errors.New("the clients are required")
+	}
+
+	grant := AccessConfig{Role: Role(args[0])}
+	if args[1] != allClients {
+		grant.Clients = strings.Split(args[1], ",")
+	}
+	if len(args) > 2 {
+		grant.Accounts = strings.Split(args[2], ",")
+	}
+
+	return grant, nil
+}
+
+// handleInvite handles /invite <role> <clients> [accounts], example: /invite viewer family acc1,acc2
+func (b *bot) handleInvite(c commandContext) {
+	message := c.Message
+
+	grant, err := parseInviteGrant(c.Args)
+
+	text := ""
+	if err != nil {
+		text = T(c.Lang, "invite_usage")
+	} else if !b.getAccess().isRole(grant.Role) {
+		text = T(c.Lang, "unknown_role", grant.Role)
+	} else if invite, err := b.createInvite(grant, int64(message.From.ID)); err != nil {
+		log.Error().Err(err).Msg("[invite] create")
+		text = err.Error()
+	} else {
+		text = T(
+			c.Lang,
+			"invite_created",
+			grant.Role,
+			invite.ExpiresAt.Format("02.01.2006 15:04"),
+			invite.Code,
+		)
+
+		if name := b.botName(); name != "" {
+			text += fmt.Sprintf("\nhttps://t.me/%s?start=%s", name, invite.Code)
+		}
+
+		log.Info().Msgf("[invite] created by %d, role %s", message.From.ID, grant.Role)
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyToMessageID = message.MessageID
+
+	if _, err := b.send(msg); err != nil {
+		log.Error().Err(err).Msg("[telegram] invite, send msg error")
+	}
+}
+
+// handleStart handles /start <code> in the private chat, it grants the role of the invite to the user,
+// /start without the code sends the help to the known users
+func (b *bot) handleStart(c commandContext) {
+	message, code := c.Message, c.Arg(0)
+	if message.Chat.ID != int64(message.From.ID) {
+		return
+	}
+
+	if code == "" {
+		if grant, ok := b.getAccess().resolve(message.Chat.ID); ok {
+			b.cmdHelp(commandContext{Message: message, Grant: grant, Lang: c.Lang})
+			return
+		}
+
+		b.reply(message, T(c.Lang, "invite_required"))
+		return
+	}
+
+	text := ""
+	grant, err := b.acceptInvite(code, int64(message.From.ID))
+	if err != nil {
+		log.Warn().Err(err).Msgf("[invite] accept by %d", message.From.ID)
+		text = T(c.Lang, "invite_not_found")
+	} else {
+		log.Info().Msgf("[invite] accepted by %d, role %s", message.From.ID, grant.Role)
+		text = T(c.Lang, "access_granted", grant.Role)
+
+		b.sendToAdmins(NewText("user_granted", message.From.String(), message.From.ID, grant.Role))
+	}
+
+	if _, err := b.send(tgbotapi.NewMessage(message.Chat.ID, text)); err != nil {
+		log.Error().Err(err).Msg("[telegram] start, send msg error")
+	}
+}
+
+// handleRevoke handles /revoke <user id or invite code>, the list of the granted users is sent without the argument
+func (b *bot) handleRevoke(c commandContext) {
+	message, ref := c.Message, c.Arg(0)
+
+	text := ""
+	if ref == "" {
+		grants, err := b.storedGrants()
+		if err != nil {
+			text = err.Error()
+		} else if len(grants) == 0 {
+			text = T(c.Lang, "no_invited_users")
+		} else {
+			lines := []string{T(c.Lang, "invited_users")}
+			for _, grant := range grants {
+				lines = append(lines, fmt.Sprintf("%d: %s", grant.ID, grant.Role))
+			}
+			text = strings.Join(lines, "\n")
+		}
+	} else if err := b.revoke(ref); err != nil {
+		text = err.Error()
+	} else {
+		log.Info().Msgf("[invite] %s revoked by %d", ref, message.From.ID)
+		text = T(c.Lang, "access_revoked")
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyToMessageID = message.MessageID
+
+	if _, err := b.send(msg); err != nil {
+		log.Error().Err(err).Msg("[telegram] revoke, send msg error")
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestInviteBot(t *testing.T) *bot {
+	storage, _ := newTestStorage(t)
+	t.Cleanup(func() { storage.Close() })
+
+	b := &bot{storage: storage}
+
+	access, err := b.loadAccess(Config{TelegramAdmins: []int64{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.access = access
+
+	return b
+}
+
+func TestInviteAccept(t *testing.T) {
+	b := newTestInviteBot(t)
+
+	invite, err := b.createInvite(AccessConfig{Role: RoleViewer, Clients: []string{"family"}}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grant, err := b.acceptInvite(invite.Code, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if grant.ID != 2 || grant.Role != RoleViewer {
+		t.Error("Expected viewer 2, got ", grant)
+	}
+
+	if grant, ok := b.getAccess().resolve(2); !ok || grant.Clients[0] != "family" {
+		t.Error("Expected family viewer, got ", grant)
+	}
+
+	// single-use
+	if _, err := b.acceptInvite(invite.Code, 3); err != errInviteNotFound {
+		t.Error("Expected errInviteNotFound, got ", err)
+	}
+
+	// the grants are loaded with the configuration
+	access, err := b.loadAccess(Config{TelegramAdmins: []int64{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := access.resolve(2); !ok {
+		t.Error("Expected stored grant, got nothing")
+	}
+
+	if err := b.revoke("2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := b.getAccess().resolve(2); ok {
+		t.Error("Expected revoked grant, got it")
+	}
+
+	if err := b.revoke("2"); err != errGrantNotFound {
+		t.Error("Expected errGrantNotFound, got ", err)
+	}
+}
+
+func TestInviteExpired(t *testing.T) {
+	b := newTestInviteBot(t)
+
+	invite, err := b.createInvite(AccessConfig{Role: RoleViewer}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invite.ExpiresAt = time.Now().Add(-time.Minute)
+	if err := b.storage.Put(invitesBucket, invite.Code, invite); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.acceptInvite(invite.Code, 2); err != errInviteNotFound {
+		t.Error("Expected errInviteNotFound, got ", err)
+	}
+
+	if err := b.pruneInvites(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := b.storage.Get(invitesBucket, invite.Code, &Invite{}); ok {
+		t.Error("Expected pruned invite, got it")
+	}
+}
+
+func TestInviteConfiguredPrecedence(t *testing.T) {
+	b := newTestInviteBot(t)
+
+	invite, err := b.createInvite(AccessConfig{Role: RoleNotifier}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.acceptInvite(invite.Code, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if grant, _ := b.getAccess().resolve(1); grant.Role != RoleOwner {
+		t.Error("Expected owner, got ", grant.Role)
+	}
+}
+
+func TestParseInviteGrant(t *testing.T) {
+	var tests = []struct {
+		args     string
+		expected AccessConfig
+		ok       bool
+	}{
+		{"viewer family", AccessConfig{Role: RoleViewer, Clients: []string{"family"}}, true},
+		{"viewer family,personal acc1,acc2", AccessConfig{Role: RoleViewer, Clients: []string{"family", "personal"}, Accounts: []string{"acc1", "acc2"}}, true},
+		{"owner *", AccessConfig{Role: RoleOwner}, true},
+		{"viewer", AccessConfig{}, false},
+		{"", AccessConfig{}, false},
+	}
+
+	for _, test := range tests {
+		grant, err := parseInviteGrant(strings.Fields(test.args))
+		if (err == nil) != test.ok || !reflect.DeepEqual(grant, test.expected) {
+			t.Error("For", test.args, "expected", test.expected, test.ok, "got", grant, err)
+		}
+	}
+}
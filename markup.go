@@ -0,0 +1,52 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// htmlTagRegexp matches the tags of the telegram HTML markup
+var htmlTagRegexp = regexp.MustCompile(`<[^>]*>`)
+
+// htmlMessage returns a message with the HTML markup rendered by the templates
+func htmlMessage(chatID int64, text string) tgbotapi.MessageConfig {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = tgbotapi.ModeHTML
+
+	return msg
+}
+
+// plainText removes the HTML markup and unescapes the entities
+func plainText(text string) string {
+	return html.UnescapeString(htmlTagRegexp.ReplaceAllString(text, ""))
+}
+
+// isMarkupError checks the telegram error about the incorrect markup of the message
+func isMarkupError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "can't parse entities")
+}
+
+// plainTextFallback returns the copy of the HTML message as the plain text
+func plainTextFallback(c tgbotapi.Chattable) (tgbotapi.Chattable, bool) {
+	switch msg := c.(type) {
+	case tgbotapi.MessageConfig:
+		if msg.ParseMode != tgbotapi.ModeHTML {
+			return nil, false
+		}
+		msg.ParseMode = ""
+		msg.Text = plainText(msg.Text)
+		return msg, true
+	case tgbotapi.EditMessageTextConfig:
+		if msg.ParseMode != tgbotapi.ModeHTML {
+			return nil, false
+		}
+		msg.ParseMode = ""
+		msg.Text = plainText(msg.Text)
+		return msg, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestStatementTemplateEscaping(t *testing.T) {
+	tmpl, err := GetTempate(statementTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := StatementMessage{
+		Name:          "Tom & Jerry",
+		StatementItem: StatementItem{Time: 1700000000, Description: "<Сільпо>", Amount: -100, OperationAmount: -100, Balance: 500},
+		Account:       Account{CurrencyCode: 980},
+	}
+
+	message, err := executeTemplate(tmpl, LangEN, nil, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "<b>Tom &amp; Jerry</b>, 00:13\n🛒 <b>-1₴</b>\n&lt;Сільпо&gt;\nBalance: <code>5₴</code>"
+	if message != expected {
+		t.Errorf("Expected %q, got %q", expected, message)
+	}
+
+	if text := plainText(message); text != "Tom & Jerry, 00:13\n🛒 -1₴\n<Сільпо>\nBalance: 5₴" {
+		t.Errorf("Expected the plain text, got %q", text)
+	}
+}
+
+func TestPlainTextFallback(t *testing.T) {
+	fallback, ok := plainTextFallback(htmlMessage(1, "<b>a &lt; b</b>"))
+	if msg, _ := fallback.(tgbotapi.MessageConfig); !ok || msg.ParseMode != "" || msg.Text != "a < b" {
+		t.Error("Expected the plain text message, got ", fallback)
+	}
+
+	edit := tgbotapi.NewEditMessageText(1, 2, "<code>1</code>")
+	edit.ParseMode = tgbotapi.ModeHTML
+	fallback, ok = plainTextFallback(edit)
+	if msg, _ := fallback.(tgbotapi.EditMessageTextConfig); !ok || msg.Text != "1" || msg.MessageID != 2 {
+		t.Error("Expected the plain text edit, got ", fallback)
+	}
+
+	if _, ok := plainTextFallback(tgbotapi.NewMessage(1, "text")); ok {
+		t.Error("Expected no fallback for the plain text message")
+	}
+
+	if !isMarkupError(errors.New("Bad Request: can't parse entities: unsupported start tag")) || isMarkupError(nil) {
+		t.Error("Expected the markup error")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = "mono_bot"
+
+var (
+	webhooksReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "webhooks_received_total",
+		Help:      "The total number of the received monobank webhooks.",
+	})
+
+	webhooksFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "webhooks_failed_total",
+		Help:      "The total number of the monobank webhooks failed to receive.",
+	}, []string{"reason"})
+
+	telegramSends = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "telegram_sends_total",
+		Help:      "The total number of the messages sent to telegram.",
+	})
+
+	telegramSendFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "telegram_send_failures_total",
+		Help:      "The total number of the messages failed to send to telegram.",
+	})
+
+	monobankRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "monobank_requests_total",
+		Help:      "The total number of the monobank api requests by endpoint and status.",
+	}, []string{"endpoint", "status"})
+
+	rateLimiterRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rate_limiter_rejections_total",
+		Help:      "The total number of the monobank api requests rejected by the client rate limiter.",
+	}, []string{"endpoint"})
+
+	accountBalance = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "account_balance",
+		Help:      "The balance of the account in the major units of the currency.",
+	}, []string{"client", "account", "type", "currency"})
+)
+
+// registerQueueDepth registers a gauge of the processing queue depth
+func registerQueueDepth(depth func() int) {
+	prometheus.MustRegister(newQueueDepth(depth))
+}
+
+// newQueueDepth returns a gauge of the processing queue depth
+func newQueueDepth(depth func() int) prometheus.GaugeFunc {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "queue_depth",
+		Help:      "The number of the webhooks waiting for processing.",
+	}, func() float64 {
+		return float64(depth())
+	})
+}
+
+// registerAccountBalance registers the balance gauge, it is opt-in because balances are sensitive
+func registerAccountBalance() {
+	prometheus.MustRegister(accountBalance)
+}
+
+func setAccountBalance(client Client, account Account) {
+	accountBalance.WithLabelValues(
+		clientKey(client),
+		account.ID,
+		account.Type,
+		fmt.Sprintf("%d", account.CurrencyCode),
+	).Set(toUnits(account.Balance))
+}
+
+// monobankEndpoint returns a label of the monobank api endpoint without ids, example: personal/statement
+func monobankEndpoint(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > 2 {
+		segments = segments[:2]
+	}
+
+	return strings.Join(segments, "/")
+}
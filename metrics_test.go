@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestWebhookMetrics(t *testing.T) {
+	b := newTestWebhookBot(t)
+
+	received := testutil.ToFloat64(webhooksReceived)
+	unmarshal := testutil.ToFloat64(webhooksFailed.WithLabelValues("unmarshal"))
+	account := testutil.ToFloat64(webhooksFailed.WithLabelValues("account"))
+
+	for _, body := range []string{
+		"{",
+		`{"type":"StatementItem","data":{"account":"fake","statementItem":{"id":"st1"}}}`,
+		`{"type":"StatementItem","data":{"account":"acc","statementItem":{"id":"st1"}}}`,
+	} {
+		b.handleWebhook(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, b.webhookPath(), strings.NewReader(body)))
+	}
+
+	var tests = []struct {
+		name     string
+		value    float64
+		expected float64
+	}{
+		{"received", testutil.ToFloat64(webhooksReceived), received + 3},
+		{"unmarshal", testutil.ToFloat64(webhooksFailed.WithLabelValues("unmarshal")), unmarshal + 1},
+		{"account", testutil.ToFloat64(webhooksFailed.WithLabelValues("account")), account + 1},
+	}
+
+	for _, test := range tests {
+		if test.value != test.expected {
+			t.Error(test.name, "expected", test.expected, "got", test.value)
+		}
+	}
+}
+
+func TestQueueDepthMetric(t *testing.T) {
+	storage, _ := newTestStorage(t)
+	t.Cleanup(func() { storage.Close() })
+
+	queue := NewQueue(storage)
+	depth := newQueueDepth(queue.Len)
+
+	if value := testutil.ToFloat64(depth); value != 0 {
+		t.Error("Expected 0, got ", value)
+	}
+
+	for _, id := range []string{"st1", "st2"} {
+		var data StatementItemData
+		data.Data.Account = "acc"
+		data.Data.StatementItem.ID = id
+
+		if _, err := queue.Push(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if value := testutil.ToFloat64(depth); value != 2 {
+		t.Error("Expected 2, got ", value)
+	}
+}
+
+func TestMonobankRequestsMetric(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/personal/client-info" {
+			w.Write([]byte(`{"name":"Name"}`))
+			return
+		}
+
+		http.Error(w, `{"errorDescription":"Too many requests"}`, http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	ok := testutil.ToFloat64(monobankRequests.WithLabelValues("personal/client-info", "200"))
+	limited := testutil.ToFloat64(monobankRequests.WithLabelValues("personal/statement", "429"))
+
+	for _, path := range []string{"/personal/client-info", "/personal/statement/acc/1/2"} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		DoRequest(ClientInfo{}, req)
+	}
+
+	if value := testutil.ToFloat64(monobankRequests.WithLabelValues("personal/client-info", "200")); value != ok+1 {
+		t.Error("Expected", ok+1, "got", value)
+	}
+
+	if value := testutil.ToFloat64(monobankRequests.WithLabelValues("personal/statement", "429")); value != limited+1 {
+		t.Error("Expected", limited+1, "got", value)
+	}
+}
+
+func TestTelegramSendsMetric(t *testing.T) {
+	b := newTestInviteBot(t)
+
+	sends := testutil.ToFloat64(telegramSends)
+	failures := testutil.ToFloat64(telegramSendFailures)
+
+	// telegram is not started
+	b.send(tgbotapi.NewMessage(1, "text"))
+
+	newTestTelegram(b)
+	b.send(tgbotapi.NewMessage(1, "text"))
+
+	if value := testutil.ToFloat64(telegramSends); value != sends+1 {
+		t.Error("Expected", sends+1, "got", value)
+	}
+
+	if value := testutil.ToFloat64(telegramSendFailures); value != failures+1 {
+		t.Error("Expected", failures+1, "got", value)
+	}
+}
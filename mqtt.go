@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	mqttTimeout = 10 * time.Second
+	// mqttQueueSize is the number of the messages waiting for the broker, the new messages are dropped if it is full
+	mqttQueueSize = 100
+)
+
+// Publisher is the interface representing publisher of the balances and transactions.
+type Publisher interface {
+	PublishBalance(client Client, account Account) error
+	PublishStatementItem(client Client, account Account, item StatementItem) error
+	Close()
+}
+
+// mqttConn is a part of the paho client used by the publisher
+type mqttConn interface {
+	Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token
+	Disconnect(quiesce uint)
+}
+
+// mqttPublisher sends the messages in the background, the webhook and telegram updates do not wait for the broker
+type mqttPublisher struct {
+	conn   mqttConn
+	prefix string
+
+	queue     chan mqttMessage
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type mqttMessage struct {
+	topic    string
+	retained bool
+	data     []byte
+}
+
+// BalancePayload is a payload of the retained balance topic
+type BalancePayload struct {
+	Client       string  `json:"client"`
+	Account      string  `json:"account"`
+	Type         string  `json:"type"`
+	Balance      float64 `json:"balance"`
+	CreditLimit  float64 `json:"creditLimit"`
+	CurrencyCode int     `json:"currencyCode"`
+	Currency     string  `json:"currency"`
+	Time         int64   `json:"time"`
+}
+
+// StatementItemPayload is a payload of the transaction topic
+type StatementItemPayload struct {
+	Client          string  `json:"client"`
+	Account         string  `json:"account"`
+	ID              string  `json:"id"`
+	Time            int     `json:"time"`
+	Description     string  `json:"description"`
+	Comment         string  `json:"comment,omitempty"`
+	Mcc             int     `json:"mcc"`
+	Category        string  `json:"category"`
+	Amount          float64 `json:"amount"`
+	OperationAmount float64 `json:"operationAmount"`
+	CurrencyCode    int     `json:"currencyCode"`
+	CashbackAmount  float64 `json:"cashbackAmount"`
+	Balance         float64 `json:"balance"`
+	Currency        string  `json:"currency"`
+	Hold            bool    `json:"hold"`
+}
+
+// NewMQTTPublisher returns a publisher connected to the MQTT broker.
+func NewMQTTPublisher(config MQTTConfig) (Publisher, error) {
+	opts := mqtt.NewClientOptions().
+		AddBroker(config.Broker).
+		SetClientID(config.ClientID).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true)
+
+	conn := mqtt.NewClient(opts)
+
+	token := conn.Connect()
+	if !token.WaitTimeout(mqttTimeout) {
+		// messages are buffered until the connection is up
+		log.Warn().Msgf("[mqtt] broker %s is unavailable, still connecting", config.Broker)
+	} else if err := token.Error(); err != nil {
+		return nil, err
+	}
+
+	return newMQTTPublisher(conn, config.TopicPrefix), nil
+}
+
+func newMQTTPublisher(conn mqttConn, prefix string) Publisher {
+	p := &mqttPublisher{
+		conn:   conn,
+		prefix: strings.TrimSuffix(prefix, "/"),
+		queue:  make(chan mqttMessage, mqttQueueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go p.run()
+
+	return p
+}
+
+// run sends the queued messages until the publisher is closed, the queued messages are sent before closing
+func (p *mqttPublisher) run() {
+	defer close(p.done)
+
+	for {
+		select {
+		case message := <-p.queue:
+			p.send(message)
+		case <-p.stop:
+			for {
+				select {
+				case message := <-p.queue:
+					p.send(message)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *mqttPublisher) send(message mqttMessage) {
+	token := p.conn.Publish(message.topic, 1, message.retained, message.data)
+	if !token.WaitTimeout(mqttTimeout) {
+		log.Error().Msgf("[mqtt] publish to %s: timeout", message.topic)
+		return
+	}
+
+	if err := token.Error(); err != nil {
+		log.Error().Err(err).Msgf("[mqtt] publish to %s", message.topic)
+	}
+}
+
+// PublishBalance publishes the retained balance of the account, topic: <prefix>/<client>/<account>/balance
+func (p *mqttPublisher) PublishBalance(client Client, account Account) error {
+	payload := BalancePayload{
+		Client:       clientKey(client),
+		Account:      account.ID,
+		Type:         account.Type,
+		Balance:      toUnits(account.Balance),
+		CreditLimit:  toUnits(account.CreditLimit),
+		CurrencyCode: account.CurrencyCode,
+		Currency:     GetCurrencySymbol(account.CurrencyCode),
+		Time:         time.Now().Unix(),
+	}
+
+	return p.publish(p.topic(client, account.ID, "balance"), true, payload)
+}
+
+// PublishStatementItem publishes the transaction of the account, topic: <prefix>/<client>/<account>/transaction
+func (p *mqttPublisher) PublishStatementItem(client Client, account Account, item StatementItem) error {
+	payload := StatementItemPayload{
+		Client:          clientKey(client),
+		Account:         account.ID,
+		ID:              item.ID,
+		Time:            item.Time,
+		Description:     item.Description,
+		Comment:         item.Comment,
+		Mcc:             item.Mcc,
+		Category:        ItemCategory(item),
+		Amount:          toUnits(item.Amount),
+		OperationAmount: toUnits(item.OperationAmount),
+		CurrencyCode:    item.CurrencyCode,
+		CashbackAmount:  toUnits(item.CashbackAmount),
+		Balance:         toUnits(item.Balance),
+		Currency:        GetCurrencySymbol(account.CurrencyCode),
+		Hold:            item.Hold,
+	}
+
+	return p.publish(p.topic(client, account.ID, "transaction"), false, payload)
+}
+
+// Close sends the queued messages and disconnects, it waits for the broker not longer than mqttTimeout
+func (p *mqttPublisher) Close() {
+	p.closeOnce.Do(func() {
+		close(p.stop)
+
+		select {
+		case <-p.done:
+		case <-time.After(mqttTimeout):
+			log.Warn().Msg("[mqtt] close, the queued messages are not sent")
+		}
+
+		p.conn.Disconnect(250)
+	})
+}
+
+// publish queues the message, the error is returned if the queue is full
+func (p *mqttPublisher) publish(topic string, retained bool, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	log.Debug().Msgf("[mqtt] publish to %s", topic)
+
+	select {
+	case p.queue <- mqttMessage{topic: topic, retained: retained, data: data}:
+		return nil
+	default:
+		return fmt.Errorf("publish to %s: the queue is full", topic)
+	}
+}
+
+func (p *mqttPublisher) topic(client Client, accountID, name string) string {
+	return strings.Join([]string{
+		p.prefix,
+		topicSegment(clientKey(client)),
+		topicSegment(accountID),
+		name,
+	}, "/")
+}
+
+// topicSegment removes the MQTT special characters from the topic level
+func topicSegment(segment string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(segment)
+}
+
+// toUnits converts the minor units of the currency to the major ones
+func toUnits(amount int) float64 {
+	return float64(amount) / 100.0
+}
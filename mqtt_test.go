@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+type publishedMessage struct {
+	topic    string
+	retained bool
+	payload  []byte
+}
+
+type fakeMQTTConn struct {
+	messages []publishedMessage
+}
+
+func (c *fakeMQTTConn) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.messages = append(c.messages, publishedMessage{topic, retained, payload.([]byte)})
+	return &mqtt.DummyToken{}
+}
+
+func (c *fakeMQTTConn) Disconnect(quiesce uint) {}
+
+func TestMQTTPublishBalance(t *testing.T) {
+	conn := &fakeMQTTConn{}
+	publisher := newMQTTPublisher(conn, "mono/")
+
+	client := &client{id: 42}
+	err := publisher.PublishBalance(client, Account{ID: "acc1", Balance: 12345, CurrencyCode: 980})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the queued messages are sent before closing
+	publisher.Close()
+
+	if len(conn.messages) != 1 {
+		t.Fatal("Expected 1, got ", len(conn.messages))
+	}
+
+	message := conn.messages[0]
+	if message.topic != "mono/42/acc1/balance" {
+		t.Error("Expected mono/42/acc1/balance, got ", message.topic)
+	}
+	if !message.retained {
+		t.Error("Expected retained message")
+	}
+
+	var payload BalancePayload
+	if err := json.Unmarshal(message.payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Balance != 123.45 {
+		t.Error("Expected 123.45, got ", payload.Balance)
+	}
+}
+
+func TestMQTTPublishStatementItem(t *testing.T) {
+	conn := &fakeMQTTConn{}
+	publisher := newMQTTPublisher(conn, "mono")
+
+	client := &client{id: 42}
+	err := publisher.PublishStatementItem(client, Account{ID: "a/b+#"}, StatementItem{ID: "st1", Amount: -500})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publisher.Close()
+
+	message := conn.messages[0]
+	if message.topic != "mono/42/a_b__/transaction" {
+		t.Error("Expected mono/42/a_b__/transaction, got ", message.topic)
+	}
+	if message.retained {
+		t.Error("Expected not retained message")
+	}
+
+	var payload StatementItemPayload
+	if err := json.Unmarshal(message.payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.ID != "st1" || payload.Amount != -5 {
+		t.Error("Unexpected payload ", string(message.payload))
+	}
+}
+
+// blockingMQTTConn blocks the publishing until it is released, like the unavailable broker
+type blockingMQTTConn struct {
+	release chan struct{}
+}
+
+func (c *blockingMQTTConn) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	<-c.release
+	return &mqtt.DummyToken{}
+}
+
+func (c *blockingMQTTConn) Disconnect(quiesce uint) {}
+
+func TestMQTTPublishQueueFull(t *testing.T) {
+	conn := &blockingMQTTConn{release: make(chan struct{})}
+	publisher := newMQTTPublisher(conn, "mono")
+
+	// the callers do not wait for the broker, the messages over the queue are dropped
+	dropped := 0
+	for i := 0; i < mqttQueueSize+2; i++ {
+		if err := publisher.PublishBalance(&client{id: 42}, Account{ID: "acc"}); err != nil {
+			dropped++
+		}
+	}
+
+	if dropped == 0 {
+		t.Error("Expected the dropped messages")
+	}
+
+	close(conn.release)
+	publisher.Close()
+}
+
+// TestMQTTLocalBroker runs against a local broker, example: MQTT_TEST_BROKER=tcp://127.0.0.1:1883
+func TestMQTTLocalBroker(t *testing.T) {
+	broker := os.Getenv("MQTT_TEST_BROKER")
+	if broker == "" {
+		t.Skip("MQTT_TEST_BROKER is not set")
+	}
+
+	received := make(chan mqtt.Message, 1)
+	subscriber := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(broker).SetClientID("mono_test_subscriber"))
+	if token := subscriber.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+	defer subscriber.Disconnect(250)
+
+	publisher, err := NewMQTTPublisher(MQTTConfig{
+		Broker:      broker,
+		ClientID:    "mono_test_publisher",
+		TopicPrefix: "mono_test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Close()
+
+	client := &client{id: 1}
+	if err := publisher.PublishBalance(client, Account{ID: "acc", Balance: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the balance is retained, so it is delivered after subscribing
+	token := subscriber.Subscribe("mono_test/1/acc/balance", 1, func(_ mqtt.Client, message mqtt.Message) {
+		received <- message
+	})
+	if token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+
+	select {
+	case message := <-received:
+		if !message.Retained() {
+			t.Error("Expected retained message")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected retained balance message")
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	queueBucket     = "queue"
+	queueSeenBucket = "queue_seen"
+
+	queueMinBackoff  = 5 * time.Second
+	queueMaxBackoff  = time.Hour
+	queueMaxAttempts = 50
+
+	// ids of the processed statements are kept to skip webhooks sent twice
+	queueSeenTTL = 30 * 24 * time.Hour
+)
+
+// QueueItem is a webhook data waiting for processing
+type QueueItem struct {
+	Key         string            `json:"-"`
+	Data        StatementItemData `json:"data"`
+	Attempts    int               `json:"attempts"`
+	NextAttempt int64             `json:"nextAttempt"`
+	LastError   string            `json:"lastError,omitempty"`
+	Delivered   []int64           `json:"delivered,omitempty"` // chats the message is already sent to
+	CreatedAt   int64             `json:"createdAt"`
+}
+
+// IsDelivered checks that the message is already sent to the chat
+func (i QueueItem) IsDelivered(chatID int64) bool {
+	for _, id := range i.Delivered {
+		if id == chatID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Queue is the interface representing durable queue of the webhook data.
+type Queue interface {
+	Push(data StatementItemData) (bool, error)
+	Due(now time.Time) ([]QueueItem, error)
+	Done(item QueueItem) error
+	Retry(item QueueItem, err error) (bool, error)
+	Prune(now time.Time) error
+	Len() int
+}
+
+type queue struct {
+	storage Storage
+}
+
+// NewQueue returns a queue object stored in the storage.
+func NewQueue(storage Storage) Queue {
+	return &queue{storage: storage}
+}
+
+// Push adds the data to the queue, false is returned if the statement was already received
+func (q *queue) Push(data StatementItemData) (bool, error) {
+	id := data.Data.StatementItem.ID
+	now := time.Now()
+
+	added := false
+	err := q.storage.Update(func(tx StorageTx) error {
+		if id != "" {
+			var seenAt int64
+			ok, err := tx.Get(queueSeenBucket, id, &seenAt)
+			if err != nil || ok {
+				return err
+			}
+
+			if err := tx.Put(queueSeenBucket, id, now.Unix()); err != nil {
+				return err
+			}
+		}
+
+		seq, err := tx.NextSequence(queueBucket)
+		if err != nil {
+			return err
+		}
+
+		added = true
+		return tx.Put(queueBucket, queueKey(seq), QueueItem{
+			Data:        data,
+			NextAttempt: now.Unix(),
+			CreatedAt:   now.Unix(),
+		})
+	})
+
+	return added, err
+}
+
+// Due returns items ready for processing in the order they were received
+func (q *queue) Due(now time.Time) ([]QueueItem, error) {
+	items := []QueueItem{}
+
+	err := q.storage.ForEach(queueBucket, func(key string, value []byte) error {
+		var item QueueItem
+		if err := json.Unmarshal(value, &item); err != nil {
+			return err
+		}
+
+		if item.NextAttempt <= now.Unix() {
+			item.Key = key
+			items = append(items, item)
+		}
+
+		return nil
+	})
+
+	return items, err
+}
+
+// Done removes the processed item from the queue
+func (q *queue) Done(item QueueItem) error {
+	return q.storage.Delete(queueBucket, item.Key)
+}
+
+// Retry schedules the item with backoff, false is returned if the item is dropped after too many attempts
+func (q *queue) Retry(item QueueItem, err error) (bool, error) {
+	item.Attempts++
+	if item.Attempts >= queueMaxAttempts {
+		return false, q.Done(item)
+	}
+
+	backoff := queueMinBackoff << (item.Attempts - 1)
+	if backoff > queueMaxBackoff || backoff <= 0 {
+		backoff = queueMaxBackoff
+	}
+
+	item.NextAttempt = time.Now().Add(backoff).Unix()
+	if err != nil {
+		item.LastError = err.Error()
+	}
+
+	return true, q.storage.Put(queueBucket, item.Key, item)
+}
+
+// Prune removes expired ids of the processed statements
+func (q *queue) Prune(now time.Time) error {
+	expired := []string{}
+
+	err := q.storage.ForEach(queueSeenBucket, func(key string, value []byte) error {
+		var seenAt int64
+		if err := json.Unmarshal(value, &seenAt); err != nil {
+			return err
+		}
+
+		if now.Sub(time.Unix(seenAt, 0)) > queueSeenTTL {
+			expired = append(expired, key)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// keys are deleted after the iteration, the bucket can not be modified while iterating
+	return q.storage.Update(func(tx StorageTx) error {
+		for _, key := range expired {
+			if err := tx.Delete(queueSeenBucket, key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Len returns a number of the items in the queue
+func (q *queue) Len() int {
+	length := 0
+	q.storage.ForEach(queueBucket, func(key string, value []byte) error {
+		length++
+		return nil
+	})
+
+	return length
+}
+
+// queueKey returns a key sorted in the order of the sequence
+func queueKey(seq uint64) string {
+	return fmt.Sprintf("%020d", seq)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestStorage(t *testing.T) (Storage, string) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	storage, err := NewStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return storage, path
+}
+
+func newStatementItemData(id string) StatementItemData {
+	data := StatementItemData{Type: "StatementItem"}
+	data.Data.Account = "acc"
+	data.Data.StatementItem.ID = id
+	return data
+}
+
+func TestQueuePushDeduplicates(t *testing.T) {
+	storage, _ := newTestStorage(t)
+	defer storage.Close()
+
+	q := NewQueue(storage)
+
+	var tests = []struct {
+		id       string
+		expected bool
+	}{
+		{"st1", true},
+		{"st2", true},
+		{"st1", false},
+	}
+
+	for _, test := range tests {
+		added, err := q.Push(newStatementItemData(test.id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added != test.expected {
+			t.Error("statement", test.id, "expected", test.expected, "got", added)
+		}
+	}
+
+	items, err := q.Due(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatal("Expected 2, got ", len(items))
+	}
+	if items[0].Data.Data.StatementItem.ID != "st1" || items[1].Data.Data.StatementItem.ID != "st2" {
+		t.Error("Expected items in the order they were received")
+	}
+
+	// processed statements are still deduplicated
+	q.Done(items[0])
+	if added, _ := q.Push(newStatementItemData("st1")); added {
+		t.Error("Expected processed statement to be skipped")
+	}
+}
+
+func TestQueueSurvivesRestart(t *testing.T) {
+	storage, path := newTestStorage(t)
+
+	if _, err := NewQueue(storage).Push(newStatementItemData("st1")); err != nil {
+		t.Fatal(err)
+	}
+	storage.Close()
+
+	storage, err := NewStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+
+	if length := NewQueue(storage).Len(); length != 1 {
+		t.Error("Expected 1, got ", length)
+	}
+}
+
+func TestQueueRetry(t *testing.T) {
+	storage, _ := newTestStorage(t)
+	defer storage.Close()
+
+	q := NewQueue(storage)
+	q.Push(newStatementItemData("st1"))
+
+	items, _ := q.Due(time.Now())
+	item := items[0]
+	item.Delivered = append(item.Delivered, 100)
+
+	retried, err := q.Retry(item, errors.New("telegram is not ready"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !retried {
+		t.Fatal("Expected the item to be retried")
+	}
+
+	if items, _ := q.Due(time.Now()); len(items) != 0 {
+		t.Error("Expected no due items, got ", len(items))
+	}
+
+	items, _ = q.Due(time.Now().Add(queueMinBackoff))
+	if len(items) != 1 {
+		t.Fatal("Expected 1, got ", len(items))
+	}
+	if items[0].Attempts != 1 || !items[0].IsDelivered(100) || items[0].LastError == "" {
+		t.Error("Unexpected retried item ", items[0])
+	}
+
+	item = items[0]
+	item.Attempts = queueMaxAttempts - 1
+	if retried, _ := q.Retry(item, nil); retried {
+		t.Error("Expected the item to be dropped")
+	}
+	if length := q.Len(); length != 0 {
+		t.Error("Expected 0, got ", length)
+	}
+}
+
+func TestQueuePrune(t *testing.T) {
+	storage, _ := newTestStorage(t)
+	defer storage.Close()
+
+	q := NewQueue(storage)
+	q.Push(newStatementItemData("st1"))
+
+	if err := q.Prune(time.Now().Add(queueSeenTTL + time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if added, _ := q.Push(newStatementItemData("st1")); !added {
+		t.Error("Expected the statement to be added after prune")
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	receiptsBucket = "receipts"
+
+	// the limit of telegram to the files sent by the bots
+	receiptsArchiveMaxSize = 50 << 20
+	receiptDownloadTimeout = 30 * time.Second
+	// receiptsArchiveWorkers is the limit of the archives built at the same time
+	receiptsArchiveWorkers = 2
+)
+
+var errReceiptsTooLarge = errors.New("the receipts are too large")
+
+var receiptHTTPClient = &http.Client{Timeout: receiptDownloadTimeout}
+
+// Receipt is a photo or a document attached to the statement item by a reply to its notification
+type Receipt struct {
+	FileID   string `json:"fileId"`
+	FileName string `json:"fileName"`
+	Path     string `json:"path,omitempty"` // the local copy if the receipts directory is set
+}
+
+// statementReceipts are the receipts of the statement item with its client, account and time to find them by the period
+type statementReceipts struct {
+	ClientID uint32    `json:"clientId"`
+	Account  string    `json:"account"`
+	Time     int       `json:"time"`
+	Files    []Receipt `json:"files"`
+}
+
+// receiptFromMessage returns the receipt of the photo or the PDF or image document of the message
+func receiptFromMessage(message *tgbotapi.Message) (Receipt, bool) {
+	if message.Photo != nil && len(*message.Photo) > 0 {
+		// the last size is the largest one
+		photos := *message.Photo
+		return Receipt{FileID: photos[len(photos)-1].FileID, FileName: "photo.jpg"}, true
+	}
+
+	if document := message.Document; document != nil {
+		if document.MimeType != "application/pdf" && !strings.HasPrefix(document.MimeType, "image/") {
+			return Receipt{}, false
+		}
+
+		name := filepath.Base(document.FileName)
+		if name == "." || name == "/" {
+			name = "document"
+		}
+
+		return Receipt{FileID: document.FileID, FileName: name}, true
+	}
+
+	return Receipt{}, false
+}
+
+// getReceipts returns the receipts of the statement item
+func (b *bot) getReceipts(statementID string) (statementReceipts, error) {
+	var receipts statementReceipts
+	_, err := b.storage.Get(receiptsBucket, statementID, &receipts)
+
+	return receipts, err
+}
+
+// attachReceipt saves the photo or the document of the reply to the notification as the receipt of its statement item,
+// false is returned if the message is not a reply to a notification with a receipt
+func (b *bot) attachReceipt(c commandContext) bool {
+	reply := c.Message.ReplyToMessage
+	if reply == nil {
+		return false
+	}
+
+	receipt, ok := receiptFromMessage(c.Message)
+	if !ok {
+		return false
+	}
+
+	ref, ok := b.getMessageRef(reply)
+	if !ok {
+		return false
+	}
+
+	client, err := b.getClientByID(ref.ClientID)
+	if err != nil || !b.canSeeAccount(c.Grant, client, ref.Account) {
+		b.denyAccess(tgbotapi.Update{Message: c.Message}, true)
+		return true
+	}
+
+	// the receipts are changed in the transaction, the local copies are added to them in the background
+	var receipts statementReceipts
+	err = b.storage.Update(func(tx StorageTx) error {
+		if _, err := tx.Get(receiptsBucket, ref.StatementID, &receipts); err != nil {
+			return err
+		}
+
+		receipts.ClientID = ref.ClientID
+		receipts.Account = ref.Account
+		receipts.Time = ref.Time
+		receipts.Files = append(receipts.Files, receipt)
+
+		return tx.Put(receiptsBucket, ref.StatementID, receipts)
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("[receipt] save receipts")
+		b.reply(c.Message, T(c.Lang, "error"))
+		return true
+	}
+
+	client.GetReport(ref.Account).UpdateItem(ref.StatementID, func(item *StatementItem) {
+		item.Receipts = len(receipts.Files)
+	})
+
+	// the file id is enough to get the file, the local copy is optional and does not block the updates
+	if dir := b.receiptsDir; dir != "" {
+		b.downloads.Add(1)
+		go func() {
+			defer b.downloads.Done()
+			b.copyReceipt(c, dir, ref.StatementID, len(receipts.Files), receipt)
+		}()
+		return true
+	}
+
+	b.reply(c.Message, T(c.Lang, "receipt_saved", len(receipts.Files)))
+	return true
+}
+
+// copyReceipt saves the local copy of the nth receipt of the statement item and replies with the result
+func (b *bot) copyReceipt(c commandContext, dir, statementID string, n int, receipt Receipt) {
+	path, err := b.saveReceiptFile(dir, statementID, n, receipt)
+	if err == nil {
+		err = b.storage.Update(func(tx StorageTx) error {
+			var receipts statementReceipts
+			if ok, err := tx.Get(receiptsBucket, statementID, &receipts); err != nil || !ok || len(receipts.Files) < n {
+				return err
+			}
+
+			receipts.Files[n-1].Path = path
+			return tx.Put(receiptsBucket, statementID, receipts)
+		})
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("[receipt] save file")
+		b.reply(c.Message, T(c.Lang, "receipt_saved_without_copy", n))
+		return
+	}
+
+	b.reply(c.Message, T(c.Lang, "receipt_saved", n))
+}
+
+// saveReceiptFile downloads the receipt to <dir>/<statement id>/<n>_<file name> and returns its path
+func (b *bot) saveReceiptFile(dir, statementID string, n int, receipt Receipt) (string, error) {
+	data, err := b.downloadFile(receipt.FileID)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, filepath.Base(statementID), fmt.Sprintf("%d_%s", n, receipt.FileName))
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+
+	return path, os.WriteFile(path, data, 0o600)
+}
+
+// downloadFile returns the content of the telegram file
+func (b *bot) downloadFile(fileID string) ([]byte, error) {
+	botAPI := b.getBotAPI()
+	if botAPI == nil {
+		return nil, errors.New("telegram is not ready")
+	}
+
+	url, err := botAPI.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := receiptHTTPClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download file: status %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, receiptsArchiveMaxSize+1))
+}
+
+// readReceipt returns the local copy of the receipt or downloads it
+func (b *bot) readReceipt(receipt Receipt) ([]byte, error) {
+	if receipt.Path != "" {
+		if data, err := os.ReadFile(receipt.Path); err == nil {
+			return data, nil
+		}
+	}
+
+	return b.downloadFile(receipt.FileID)
+}
+
+// findReceipts returns the receipts of the period which the access can see, ordered by the time
+func (b *bot) findReceipts(grant AccessConfig, from, to time.Time) ([]statementReceipts, error) {
+	found := []statementReceipts{}
+	err := b.storage.ForEach(receiptsBucket, func(key string, value []byte) error {
+		var receipts statementReceipts
+		if err := json.Unmarshal(value, &receipts); err != nil {
+			return nil
+		}
+
+		if receipts.Time < int(from.Unix()) || receipts.Time >= int(to.Unix()) {
+			return nil
+		}
+
+		client, err := b.getClientByID(receipts.ClientID)
+		if err != nil || !b.canSeeAccount(grant, client, receipts.Account) {
+			return nil
+		}
+
+		found = append(found, receipts)
+		return nil
+	})
+
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Time < found[j].Time })
+
+	return found, err
+}
+
+// buildReceiptsArchive returns the zip archive of the receipts, the files are named by the time of the statement item
+func buildReceiptsArchive(receipts []statementReceipts, loc *time.Location, read func(Receipt) ([]byte, error)) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	n := 0
+	for _, statement := range receipts {
+		for _, receipt := range statement.Files {
+			data, err := read(receipt)
+			if err != nil {
+				return nil, err
+			}
+
+			n++
+			name := fmt.Sprintf("%s_%d_%s", FormatDate(loc, statement.Time, "2006-01-02_1504"), n, receipt.FileName)
+			w, err := archive.Create(name)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, err := w.Write(data); err != nil {
+				return nil, err
+			}
+
+			if buf.Len() > receiptsArchiveMaxSize {
+				return nil, errReceiptsTooLarge
+			}
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	if buf.Len() > receiptsArchiveMaxSize {
+		return nil, errReceiptsTooLarge
+	}
+
+	return buf.Bytes(), nil
+}
+
+// cmdReceipts sends the zip archive of the receipts of the month, the current month without the argument,
+// example: /receipts 2026-10
+func (b *bot) cmdReceipts(c commandContext) {
+	loc := b.timezone(c.Message.Chat.ID)
+
+	now := time.Now().In(loc)
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	if month := c.Arg(0); month != "" {
+		var err error
+		if from, err = time.ParseInLocation("2006-01", month, loc); err != nil {
+			b.reply(c.Message, T(c.Lang, "receipts_usage"))
+			return
+		}
+	}
+	to := from.AddDate(0, 1, 0)
+
+	receipts, err := b.findReceipts(c.Grant, from, to)
+	if err != nil {
+		log.Error().Err(err).Msg("[receipt] find receipts")
+		b.reply(c.Message, T(c.Lang, "error"))
+		return
+	}
+
+	if len(receipts) == 0 {
+		b.reply(c.Message, T(c.Lang, "receipts_not_found", from.Format("2006-01")))
+		return
+	}
+
+	// the downloads of the receipts take minutes, the archive is sent without blocking the updates
+	select {
+	case b.receiptsArchives <- struct{}{}:
+	default:
+		b.reply(c.Message, T(c.Lang, "receipts_busy"))
+		return
+	}
+
+	b.downloads.Add(1)
+	go func() {
+		defer b.downloads.Done()
+		defer func() { <-b.receiptsArchives }()
+
+		b.sendReceiptsArchive(c, receipts, from, loc)
+	}()
+}
+
+// sendReceiptsArchive downloads the receipts and sends the zip archive of the month as the reply
+func (b *bot) sendReceiptsArchive(c commandContext, receipts []statementReceipts, from time.Time, loc *time.Location) {
+	data, err := buildReceiptsArchive(receipts, loc, b.readReceipt)
+	if errors.Is(err, errReceiptsTooLarge) {
+		b.reply(c.Message, T(c.Lang, "receipts_too_large"))
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("[receipt] build archive")
+		b.reply(c.Message, T(c.Lang, "error"))
+		return
+	}
+
+	document := tgbotapi.NewDocumentUpload(c.Message.Chat.ID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("receipts_%s.zip", from.Format("2006-01")),
+		Bytes: data,
+	})
+	document.ReplyToMessageID = c.Message.MessageID
+
+	if _, err := b.send(document); err != nil {
+		log.Error().Err(err).Msg("[receipt] send archive")
+	}
+}
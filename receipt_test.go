@@ -0,0 +1,189 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestReceiptFromMessage(t *testing.T) {
+	var tests = []struct {
+		message  tgbotapi.Message
+		expected Receipt
+		ok       bool
+	}{
+		{tgbotapi.Message{Photo: &[]tgbotapi.PhotoSize{{FileID: "small"}, {FileID: "large"}}}, Receipt{FileID: "large", FileName: "photo.jpg"}, true},
+		{tgbotapi.Message{Document: &tgbotapi.Document{FileID: "pdf", FileName: "../check.pdf", MimeType: "application/pdf"}}, Receipt{FileID: "pdf", FileName: "check.pdf"}, true},
+		{tgbotapi.Message{Document: &tgbotapi.Document{FileID: "doc", FileName: "check.docx", MimeType: "application/msword"}}, Receipt{}, false},
+		{tgbotapi.Message{Text: "text"}, Receipt{}, false},
+	}
+
+	for _, test := range tests {
+		receipt, ok := receiptFromMessage(&test.message)
+		if ok != test.ok || receipt != test.expected {
+			t.Error("Expected", test.expected, test.ok, "got", receipt, ok)
+		}
+	}
+}
+
+func TestAttachReceipt(t *testing.T) {
+	b := newTestInviteBot(t)
+
+	client := NewClient(ClientConfig{Alias: "family"})
+	b.setClients([]Client{client}, map[uint32]*clientSettings{client.GetID(): {}})
+
+	update := newTestReportUpdate("1:rp:AAAAAAAA:0:1")
+	client.GetReport("account").SetGridData(update, []StatementItem{{ID: "st1"}})
+
+	notification := tgbotapi.Message{MessageID: 7, Chat: &tgbotapi.Chat{ID: 2}}
+	ref := messageRef{ClientID: client.GetID(), Account: "account", StatementID: "st1", Time: 1700000000}
+	if err := b.saveMessageRef(notification, ref); err != nil {
+		t.Fatal(err)
+	}
+
+	reply := func(message tgbotapi.Message, grant AccessConfig) bool {
+		message.Chat = &tgbotapi.Chat{ID: 2}
+		message.From = &tgbotapi.User{ID: 2}
+		message.ReplyToMessage = &notification
+		return b.attachReceipt(commandContext{Message: &message, Grant: grant, Lang: LangEN})
+	}
+
+	owner := AccessConfig{Role: RoleOwner}
+	if reply(tgbotapi.Message{Text: "hotel"}, owner) {
+		t.Error("Expected no receipt of the text")
+	}
+
+	photo := tgbotapi.Message{Photo: &[]tgbotapi.PhotoSize{{FileID: "photo"}}}
+	document := tgbotapi.Message{Document: &tgbotapi.Document{FileID: "pdf", FileName: "check.pdf", MimeType: "application/pdf"}}
+	if !reply(photo, owner) || !reply(document, owner) {
+		t.Fatal("Expected the receipts of the notification")
+	}
+
+	receipts, err := b.getReceipts("st1")
+	expected := statementReceipts{ClientID: client.GetID(), Account: "account", Time: 1700000000, Files: []Receipt{
+		{FileID: "photo", FileName: "photo.jpg"},
+		{FileID: "pdf", FileName: "check.pdf"},
+	}}
+	if err != nil || !reflect.DeepEqual(receipts, expected) {
+		t.Error("Expected the saved receipts, got ", receipts, err)
+	}
+
+	r := client.GetReport("account").(*report)
+	if items := r.cache[r.getCacheKay(update)]; items[0].Receipts != 2 {
+		t.Error("Expected 2 receipts of the item in the report, got ", items[0].Receipts)
+	}
+
+	// the receipts are found by the period and the access
+	month := time.Date(2023, time.November, 1, 0, 0, 0, 0, time.UTC)
+	found, err := b.findReceipts(owner, month, month.AddDate(0, 1, 0))
+	if err != nil || len(found) != 1 {
+		t.Error("Expected the receipts of the month, got ", found, err)
+	}
+
+	found, _ = b.findReceipts(owner, month.AddDate(0, 1, 0), month.AddDate(0, 2, 0))
+	if len(found) != 0 {
+		t.Error("Expected no receipts of the next month, got ", found)
+	}
+
+	viewer := AccessConfig{Role: RoleViewer, Clients: []string{"family"}, Accounts: []string{"other"}}
+	found, _ = b.findReceipts(viewer, month, month.AddDate(0, 1, 0))
+	if len(found) != 0 {
+		t.Error("Expected no receipts of the hidden account, got ", found)
+	}
+}
+
+func TestBuildReceiptsArchive(t *testing.T) {
+	receipts := []statementReceipts{
+		{Time: 1700000000, Files: []Receipt{{FileID: "photo", FileName: "photo.jpg"}, {FileID: "pdf", FileName: "check.pdf"}}},
+		{Time: 1700100000, Files: []Receipt{{FileID: "photo2", FileName: "photo.jpg"}}},
+	}
+
+	read := func(receipt Receipt) ([]byte, error) {
+		return []byte(receipt.FileID), nil
+	}
+
+	data, err := buildReceiptsArchive(receipts, time.UTC, read)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+
+	expected := []string{"2023-11-14_2213_1_photo.jpg", "2023-11-14_2213_2_check.pdf", "2023-11-16_0200_3_photo.jpg"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Error("Expected", expected, "got", names)
+	}
+}
+
+func TestAttachReceiptCopy(t *testing.T) {
+	b := newTestInviteBot(t)
+	b.receiptsDir = t.TempDir()
+
+	client := NewClient(ClientConfig{Alias: "family"})
+	b.setClients([]Client{client}, map[uint32]*clientSettings{client.GetID(): {}})
+
+	notification := tgbotapi.Message{MessageID: 7, Chat: &tgbotapi.Chat{ID: 2}}
+	if err := b.saveMessageRef(notification, messageRef{ClientID: client.GetID(), Account: "account", StatementID: "st1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the receipt is saved before the download, telegram is not ready in the test
+	message := tgbotapi.Message{
+		Chat:           &tgbotapi.Chat{ID: 2},
+		From:           &tgbotapi.User{ID: 2},
+		ReplyToMessage: &notification,
+		Photo:          &[]tgbotapi.PhotoSize{{FileID: "photo"}},
+	}
+	if !b.attachReceipt(commandContext{Message: &message, Grant: AccessConfig{Role: RoleOwner}, Lang: LangEN}) {
+		t.Fatal("Expected the receipt of the notification")
+	}
+	b.downloads.Wait()
+
+	receipts, err := b.getReceipts("st1")
+	if err != nil || len(receipts.Files) != 1 || receipts.Files[0].Path != "" {
+		t.Error("Expected the receipt without the local copy, got ", receipts, err)
+	}
+}
+
+func TestCmdReceiptsWorkers(t *testing.T) {
+	b := newTestInviteBot(t)
+	b.receiptsArchives = make(chan struct{}, 1)
+
+	client := NewClient(ClientConfig{Alias: "family"})
+	b.setClients([]Client{client}, map[uint32]*clientSettings{client.GetID(): {}})
+
+	receipts := statementReceipts{ClientID: client.GetID(), Account: "account", Time: int(time.Now().Unix()), Files: []Receipt{{FileID: "photo", FileName: "photo.jpg"}}}
+	if err := b.storage.Put(receiptsBucket, "st1", receipts); err != nil {
+		t.Fatal(err)
+	}
+
+	c := commandContext{Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 2}, From: &tgbotapi.User{ID: 2}}, Grant: AccessConfig{Role: RoleOwner}, Lang: LangEN}
+
+	// the worker is busy, the archive is not built
+	b.receiptsArchives <- struct{}{}
+	b.cmdReceipts(c)
+	b.downloads.Wait()
+	if len(b.receiptsArchives) != 1 {
+		t.Error("Expected the busy worker")
+	}
+
+	// the archive is built in the background and the worker is released
+	<-b.receiptsArchives
+	b.cmdReceipts(c)
+	b.downloads.Wait()
+	if len(b.receiptsArchives) != 0 {
+		t.Error("Expected the released worker")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/rs/zerolog/log"
+)
+
+// publicWebhookURL returns the monobank webhook url based on the public url of the bot
+func (b *bot) publicWebhookURL() string {
+	if b.publicURL == "" {
+		return ""
+	}
+
+	return strings.TrimSuffix(b.publicURL, "/") + b.webhookPath()
+}
+
+// WebhookCheckStart registers the monobank webhooks of the clients if they differ from the public url,
+// and re-checks them periodically because monobank disables a webhook after failed deliveries.
+func (b *bot) WebhookCheckStart(ctx context.Context) error {
+	webhookURL := b.publicWebhookURL()
+
+	// monobank validates the url, so the http server has to be up, and the results are sent to telegram
+	for !b.health.IsUp("webhook") || !b.health.IsUp("telegram") {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+
+	b.health.Up("webhook_check")
+
+	for {
+		// the results of the clients of the users are sent only to their owners
+		for owner, results := range b.checkWebhooks(ctx, webhookURL) {
+			if owner == 0 {
+				b.sendToAdmins(results...)
+			} else {
+				b.sendTexts([]int64{owner}, results...)
+			}
+		}
+
+		// the periodic check is disabled, the subsystem stays idle until the context is done
+		interval := b.webhookCheckInterval
+		if interval <= 0 {
+			<-ctx.Done()
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// checkWebhooks sets the webhook url for clients with a different one, it returns results to report by the owner
+// of the client, the configured clients have the owner 0 and their results are sent to the admins
+func (b *bot) checkWebhooks(ctx context.Context, webhookURL string) map[int64][]Text {
+	results := map[int64][]Text{}
+
+	for _, client := range b.getClients() {
+		owner := b.getClientSettings(client).owner
+
+		info, err := client.RefreshInfo(ctx)
+		if ctx.Err() != nil {
+			return results
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("[webhook check] refresh info")
+			results[owner] = append(results[owner], NewText("client_error", client.GetName(), err))
+			continue
+		}
+
+		if info.WebHookURL == webhookURL {
+			continue
+		}
+
+		// the info of the refresh is reused, the limiter is waited once for the client-info limit of monobank
+		log.Info().Msgf("[webhook check] %s, webhook is %q, setting", client.GetName(), info.WebHookURL)
+
+		response, err := client.SetWebHook(webhookURL)
+		if err != nil {
+			log.Error().Err(err).Msg("[webhook check] set webhook")
+			results[owner] = append(results[owner], NewText("client_error", client.GetName(), err))
+			continue
+		}
+
+		status := response.Status
+		if status == "" {
+			status = fmt.Sprintf("error: %s", response.ErrorDescription)
+		}
+
+		results[owner] = append(results[owner], NewText("webhook_set", client.GetName(), status))
+	}
+
+	return results
+}
+
+// sendToAdmins sends the lines of the texts to the admins in their languages
+func (b *bot) sendToAdmins(texts ...Text) {
+	b.sendTexts(b.admins(), texts...)
+}
+
+// sendTexts sends the lines of the texts to the chats in their languages
+func (b *bot) sendTexts(chatIDs []int64, texts ...Text) {
+	for _, chatID := range chatIDs {
+		lang := b.language(chatID)
+
+		lines := make([]string, 0, len(texts))
+		for _, text := range texts {
+			lines = append(lines, text.In(lang))
+		}
+
+		if _, err := b.send(tgbotapi.NewMessage(chatID, strings.Join(lines, "\n"))); err != nil {
+			log.Error().Err(err).Msg("[telegram] send to admin")
+		}
+	}
+}
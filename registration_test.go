@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// unavailableClient is a client of the failed monobank requests
+type unavailableClient struct {
+	Client
+}
+
+func (c unavailableClient) RefreshInfo(ctx context.Context) (ClientInfo, error) {
+	return ClientInfo{}, errors.New("unavailable")
+}
+
+func TestCheckWebhooksOwners(t *testing.T) {
+	b := newTestInviteBot(t)
+
+	family := unavailableClient{NewClient(ClientConfig{Alias: "family"})}
+	user := unavailableClient{NewClient(ClientConfig{Alias: "user"})}
+	b.setClients([]Client{family, user}, map[uint32]*clientSettings{family.GetID(): {}, user.GetID(): {owner: 7}})
+
+	// the errors of the clients of the users are not sent to the admins
+	results := b.checkWebhooks(context.Background(), "https://example.com/webhook")
+	if len(results) != 2 || len(results[0]) != 1 || len(results[7]) != 1 {
+		t.Fatal("Expected the results of the admins and the owner 7, got ", results)
+	}
+
+	if text := results[0][0].In(LangEN); text != T(LangEN, "client_error", family.GetName(), "unavailable") {
+		t.Error("Expected the error of the configured client, got ", text)
+	}
+}
+
+// webhookClient is a client of the monobank info with the other webhook
+type webhookClient struct {
+	Client
+	refreshes int
+	webhook   string
+}
+
+func (c *webhookClient) RefreshInfo(ctx context.Context) (ClientInfo, error) {
+	c.refreshes++
+	return ClientInfo{Name: "Family", WebHookURL: "https://old.example.com"}, nil
+}
+
+func (c *webhookClient) SetWebHook(url string) (WebHookResponse, error) {
+	c.webhook = url
+	return WebHookResponse{Status: "ok"}, nil
+}
+
+func TestCheckWebhooksSet(t *testing.T) {
+	b := newTestInviteBot(t)
+
+	family := &webhookClient{Client: NewClient(ClientConfig{Alias: "family"})}
+	b.setClients([]Client{family}, map[uint32]*clientSettings{family.GetID(): {}})
+
+	results := b.checkWebhooks(context.Background(), "https://example.com/webhook")
+	if family.refreshes != 1 || family.webhook != "https://example.com/webhook" || len(results[0]) != 1 {
+		t.Error("Expected one refresh and the set webhook, got ", family.refreshes, family.webhook, results)
+	}
+}
@@ -1,9 +1,9 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
 	"html/template"
+	"strconv"
 	"strings"
 
 	"github.com/rs/zerolog/log"
@@ -35,15 +35,25 @@ var reportCommant = map[string]string{
 	"December":  "12",
 }
 
+// reportPeriods are the periods of the report buttons, the index is the period in the callback data
+var reportPeriods = []string{
+	"Today", "This week", "Last week", "This month", "Last month",
+	"January", "February", "March", "April", "May", "June",
+	"July", "August", "September", "October", "November", "December",
+}
+
 // Report is the interface representing report object.
 type Report interface {
-	GetKeyboarButtonConfig(update tgbotapi.Update, clientID uint32) tgbotapi.EditMessageTextConfig
+	GetKeyboarButtonConfig(update tgbotapi.Update, session string, lang Lang) tgbotapi.EditMessageTextConfig
 	IsReportGridCommand(update tgbotapi.Update) bool
 	IsReportGridPageCommand(update tgbotapi.Update) bool
-	GetReportGrid(update tgbotapi.Update, clientID uint32) tgbotapi.EditMessageTextConfig
-	GetUpdatedReportGrid(update tgbotapi.Update) (tgbotapi.EditMessageTextConfig, error)
+	GetReportGrid(update tgbotapi.Update, view ReportView) tgbotapi.EditMessageTextConfig
+	GetUpdatedReportGrid(update tgbotapi.Update, view ReportView) (tgbotapi.EditMessageTextConfig, error)
+	GetItemDetail(update tgbotapi.Update, data pageData, view ReportView, name string, account Account) (tgbotapi.EditMessageTextConfig, error)
+	GetItem(update tgbotapi.Update, statementID string) (StatementItem, error)
 	IsExistGridData(update tgbotapi.Update) bool
 	SetGridData(update tgbotapi.Update, items []StatementItem)
+	UpdateItem(statementID string, update func(item *StatementItem))
 	GetPeriodFromUpdate(update tgbotapi.Update) string
 	ResetLastData()
 	IsAccount(accountId string) bool
@@ -54,11 +64,60 @@ type report struct {
 
 	prefix    string
 	perPage   int
-	tmpl      *template.Template
 	accountId string
 	clientId  uint32
 }
 
+// ReportView is the options to render the report pages for the chat
+type ReportView struct {
+	Tmpl *template.Template
+	Lang Lang
+	Loc  *time.Location
+	Tag  string // only the items with the tag are shown if it is set
+
+	Categorize func(item *StatementItem) // sets the categories of the rendered items if it is set
+
+	// Session saves the statement ids of the items of the page for the detail buttons,
+	// the buttons have the session of the report if it is not set
+	Session func(items []string, offset int) (string, error)
+}
+
+// categorize sets the categories of the items, they are set on every render to apply the changed rules
+func (v ReportView) categorize(items []StatementItem) {
+	if v.Categorize == nil {
+		return
+	}
+
+	for i := range items {
+		v.Categorize(&items[i])
+	}
+}
+
+// detailData returns the callback data of the detail buttons of the page, the items are found by the ids
+// of the session, the numbers of the items are changed by the new statements of the period
+func (v ReportView) detailData(data pageData, items []StatementItem, offset int) pageData {
+	if v.Session == nil {
+		return data
+	}
+
+	ids := []string{}
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+
+	session, err := v.Session(ids, offset)
+	if err != nil {
+		log.Error().Err(err).Msg("[report] detail session")
+		return data
+	}
+
+	data.Session = session
+	data.Items = ids
+	data.Offset = offset
+
+	return data
+}
+
 // ReportPage is a structure to render  report content the telegram
 type ReportPage struct {
 	StatementItems      []StatementItem // items per page
@@ -67,21 +126,16 @@ type ReportPage struct {
 	CurrencyCode        int             // total for the period
 	CashbackAmountTotal int             // total for the period
 	Period              string
+	Tag                 string // the filter of the items
 }
 
 // NewReport returns a report object.
 func NewReport(accountId string, clientId uint32) Report {
 
-	tmpl, err := GetTempate(reportPageTemplate)
-	if err != nil {
-		log.Fatal().Err(err).Msg("[template]")
-	}
-
 	return &report{
 		prefix:    "rr",
 		perPage:   5,
 		cache:     map[string][]StatementItem{},
-		tmpl:      tmpl,
 		accountId: accountId,
 		clientId:  clientId,
 	}
@@ -100,9 +154,10 @@ func (r *report) getCacheKay(update tgbotapi.Update) string {
 		fromID = update.Message.From.ID
 		chatID = update.Message.Chat.ID
 	} else {
-		data := callbackQueryDataParser(update.CallbackQuery.Data)
+		// the data is checked before, an incorrect one gets an empty period
+		data, _ := callbackQueryDataParser(update.CallbackQuery.Data)
 		key = data.Period
-		clientID = data.ClientID
+		clientID = r.clientId
 
 		fromID = update.CallbackQuery.Message.ReplyToMessage.From.ID
 		chatID = update.CallbackQuery.Message.ReplyToMessage.Chat.ID
@@ -124,28 +179,41 @@ func (r report) IsExistGridData(update tgbotapi.Update) bool {
 	return ok
 }
 
-func (r *report) GetReportGrid(update tgbotapi.Update, clientID uint32) tgbotapi.EditMessageTextConfig {
-	items := r.cache[r.getCacheKay(update)]
-	data := callbackQueryDataParser(update.CallbackQuery.Data)
+// UpdateItem updates the cached statement item, example: the note of the item is changed
+func (r *report) UpdateItem(statementID string, update func(item *StatementItem)) {
+	for _, items := range r.cache {
+		for i := range items {
+			if items[i].ID == statementID {
+				update(&items[i])
+			}
+		}
+	}
+}
+
+func (r *report) GetReportGrid(update tgbotapi.Update, view ReportView) tgbotapi.EditMessageTextConfig {
+	items := filterByTag(r.cache[r.getCacheKay(update)], view.Tag)
+	data, _ := callbackQueryDataParser(update.CallbackQuery.Data)
+
+	// the first page always exists
+	page, _ := r.buildReportPage(items, 1, r.perPage, view.Tag)
+	view.categorize(page.StatementItems)
 
-	var tpl bytes.Buffer
-	err := r.tmpl.Execute(&tpl, r.buildReportPage(items, 1, r.perPage))
+	message, err := executeTemplate(view.Tmpl, view.Lang, view.Loc, page)
 	if err != nil {
 		log.Error().Err(err).Msg("[processing] template execute error")
 		return tgbotapi.EditMessageTextConfig{}
 	}
-	message := tpl.String()
 
 	tgMessage := update.Message
 	if tgMessage == nil && update.CallbackQuery != nil {
 		tgMessage = update.CallbackQuery.Message
 	}
 
-	inlineKeyboardMarkup := tgbotapi.NewInlineKeyboardMarkup(
-		getPaginateButtons(len(items), 1, r.perPage, callbackQueryDataBuilder(r.prefix, data)))
+	inlineKeyboardMarkup := r.reportKeyboard(len(items), 1, data, view.detailData(data, page.StatementItems, 0))
 
 	messageConfig := tgbotapi.EditMessageTextConfig{}
 	messageConfig.Text = message
+	messageConfig.ParseMode = tgbotapi.ModeHTML
 	messageConfig.ChatID = tgMessage.Chat.ID
 	// messageConfig.ReplyToMessageID = tgMessage.MessageID
 	messageConfig.MessageID = tgMessage.MessageID
@@ -154,45 +222,148 @@ func (r *report) GetReportGrid(update tgbotapi.Update, clientID uint32) tgbotapi
 	return messageConfig
 }
 
-func (r report) GetUpdatedReportGrid(update tgbotapi.Update) (tgbotapi.EditMessageTextConfig, error) {
-	items := r.cache[r.getCacheKay(update)]
-	data := callbackQueryDataParser(update.CallbackQuery.Data)
+func (r report) GetUpdatedReportGrid(update tgbotapi.Update, view ReportView) (tgbotapi.EditMessageTextConfig, error) {
+	items := filterByTag(r.cache[r.getCacheKay(update)], view.Tag)
+	data, err := callbackQueryDataParser(update.CallbackQuery.Data)
+	if err != nil {
+		return tgbotapi.EditMessageTextConfig{}, err
+	}
+
+	page, err := r.buildReportPage(items, data.Page, r.perPage, view.Tag)
+	if err != nil {
+		return tgbotapi.EditMessageTextConfig{}, err
+	}
+	view.categorize(page.StatementItems)
 
-	var tpl bytes.Buffer
-	err := r.tmpl.Execute(&tpl, r.buildReportPage(items, data.Page, r.perPage))
+	message, err := executeTemplate(view.Tmpl, view.Lang, view.Loc, page)
 	if err != nil {
 		log.Error().Err(err).Msg("[processing] template execute error")
 		return tgbotapi.EditMessageTextConfig{}, err
 	}
-	message := tpl.String()
 
-	inlineKeyboardMarkup := tgbotapi.NewInlineKeyboardMarkup(
-		getPaginateButtons(
-			len(items),
-			data.Page,
-			r.perPage,
-			callbackQueryDataBuilder(r.prefix, data),
-		),
+	inlineKeyboardMarkup := r.reportKeyboard(len(items), data.Page, data, view.detailData(data, page.StatementItems, (data.Page-1)*r.perPage))
+
+	messageConfig := tgbotapi.NewEditMessageText(
+		update.CallbackQuery.Message.Chat.ID,
+		update.CallbackQuery.Message.MessageID,
+		message,
 	)
 
+	messageConfig.ParseMode = tgbotapi.ModeHTML
+	messageConfig.ReplyMarkup = &inlineKeyboardMarkup
+
+	return messageConfig, nil
+}
+
+// GetItemDetail returns the detail of the item by its number in the period, the number is the page of the callback data
+// and the session has the id of the item, the back button opens the page of the item
+func (r report) GetItemDetail(update tgbotapi.Update, data pageData, view ReportView, name string, account Account) (tgbotapi.EditMessageTextConfig, error) {
+	statementID, err := data.itemID(data.Page)
+	if err != nil {
+		return tgbotapi.EditMessageTextConfig{}, err
+	}
+
+	item, err := r.GetItem(update, statementID)
+	if err != nil {
+		return tgbotapi.EditMessageTextConfig{}, err
+	}
+	items := []StatementItem{item}
+	view.categorize(items)
+
+	message, err := executeTemplate(view.Tmpl, view.Lang, view.Loc, StatementMessage{
+		Name:          name,
+		StatementItem: items[0],
+		Account:       account,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("[processing] template execute error")
+		return tgbotapi.EditMessageTextConfig{}, err
+	}
+
+	back := callbackQueryDataBuilder(r.prefix, data) + strconv.Itoa((data.Page-1)/r.perPage+1)
+	category := callbackQueryDataBuilder("rk", data) + strconv.Itoa(data.Page)
+	inlineKeyboardMarkup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.InlineKeyboardButton{Text: T(view.Lang, "back"), CallbackData: &back},
+		tgbotapi.InlineKeyboardButton{Text: T(view.Lang, "category_change"), CallbackData: &category},
+	))
+
 	messageConfig := tgbotapi.NewEditMessageText(
 		update.CallbackQuery.Message.Chat.ID,
 		update.CallbackQuery.Message.MessageID,
 		message,
 	)
 
+	messageConfig.ParseMode = tgbotapi.ModeHTML
 	messageConfig.ReplyMarkup = &inlineKeyboardMarkup
 
 	return messageConfig, nil
 }
 
-func (r report) buildReportPage(items []StatementItem, page, limit int) ReportPage {
+// GetItem returns the item of the period by its statement id, the item which is not in the period is outdated
+func (r report) GetItem(update tgbotapi.Update, statementID string) (StatementItem, error) {
+	for _, item := range r.cache[r.getCacheKay(update)] {
+		if item.ID == statementID {
+			return item, nil
+		}
+	}
+
+	return StatementItem{}, errCallbackOutdated
+}
+
+// reportKeyboard returns the numbered buttons of the items on the page with the detail data and the buttons of the pages
+func (r report) reportKeyboard(total, page int, data, detail pageData) tgbotapi.InlineKeyboardMarkup {
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+
+	items := []tgbotapi.InlineKeyboardButton{}
+	for i := (page - 1) * r.perPage; i >= 0 && i < total && i < page*r.perPage; i++ {
+		// the detail gets the number of the item in the period instead of the page
+		d := callbackQueryDataBuilder("rd", detail) + strconv.Itoa(i+1)
+		items = append(items, tgbotapi.InlineKeyboardButton{
+			Text:         strconv.Itoa(i - (page-1)*r.perPage + 1),
+			CallbackData: &d,
+		})
+	}
+	if len(items) > 0 {
+		rows = append(rows, items)
+	}
+
+	if pages := getPaginateButtons(total, page, r.perPage, callbackQueryDataBuilder(r.prefix, data)); len(pages) > 0 {
+		rows = append(rows, pages)
+	}
+
+	return tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// filterByTag returns the items with the tag, all items without the tag
+func filterByTag(items []StatementItem, tag string) []StatementItem {
+	if tag == "" {
+		return items
+	}
+
+	filtered := []StatementItem{}
+	for _, item := range items {
+		if contains(item.Tags, tag) {
+			filtered = append(filtered, item)
+		}
+	}
+
+	return filtered
+}
+
+// buildReportPage returns the page of the items, errCallbackOutdated is returned if the page does not exist,
+// example: the button of the report which had more items before the reset
+func (r report) buildReportPage(items []StatementItem, page, limit int, tag string) (ReportPage, error) {
 	total := len(items)
 	totalPages := int(total / limit)
 	if total%limit != 0 {
 		totalPages++
 	}
 
+	// the empty report has the empty first page
+	if page < 1 || (page > totalPages && page != 1) {
+		return ReportPage{}, errCallbackOutdated
+	}
+
 	var amountTotal int
 	var cashbackAmountTotal int
 	var spentTotal int
@@ -222,12 +393,13 @@ func (r report) buildReportPage(items []StatementItem, page, limit int) ReportPa
 		CurrencyCode:        currencyCode,
 		SpentTotal:          spentTotal,
 		CashbackAmountTotal: cashbackAmountTotal,
-	}
+		Tag:                 tag,
+	}, nil
 }
 
 func (r report) IsReportGridPageCommand(update tgbotapi.Update) bool {
-	data := update.CallbackQuery.Data
-	return strings.HasPrefix(data, r.prefix)
+	data, err := callbackQueryDataParser(update.CallbackQuery.Data)
+	return err == nil && data.Prefix == r.prefix
 }
 
 func (r report) IsReportGridCommand(update tgbotapi.Update) bool {
@@ -235,115 +407,56 @@ func (r report) IsReportGridCommand(update tgbotapi.Update) bool {
 	return ok
 }
 
-func (r report) GetKeyboarButtonConfig(update tgbotapi.Update, clientID uint32) tgbotapi.EditMessageTextConfig {
+func (r report) GetKeyboarButtonConfig(update tgbotapi.Update, session string, lang Lang) tgbotapi.EditMessageTextConfig {
 	tgMessage := update.Message
 	if tgMessage == nil && update.CallbackQuery != nil {
 		tgMessage = update.CallbackQuery.Message
 	}
 
-	callbackQueryDataPerion := func(p string) *string {
+	button := func(period string) tgbotapi.InlineKeyboardButton {
 		d := callbackQueryDataBuilder("rp", pageData{
-			// Page:     1,
-			Period:   strings.ReplaceAll(p, " ", "_"),
-			ChatID:   tgMessage.Chat.ID,
-			FromID:   tgMessage.From.ID,
-			ClientID: r.clientId,
-			Account:  r.accountId,
+			Session: session,
+			Period:  period,
 		})
 
 		// add page number
 		d = d + "1"
 
-		return &d
-	}
-
-	custom := []tgbotapi.InlineKeyboardButton{
-		{
-			Text:         "Today",
-			CallbackData: callbackQueryDataPerion("Today"),
-		},
-		{
-			Text:         "This week",
-			CallbackData: callbackQueryDataPerion("This week"),
-		},
-		{
-			Text:         "Last week",
-			CallbackData: callbackQueryDataPerion("Last week"),
-		},
-		{
-			Text:         "This month",
-			CallbackData: callbackQueryDataPerion("This month"),
-		},
-		{
-			Text:         "Last month",
-			CallbackData: callbackQueryDataPerion("Last month"),
-		},
-	}
-	months := []tgbotapi.InlineKeyboardButton{
-		{
-			Text:         "January",
-			CallbackData: callbackQueryDataPerion("January"),
-		},
-		{
-			Text:         "February",
-			CallbackData: callbackQueryDataPerion("February"),
-		},
-		{
-			Text:         "March",
-			CallbackData: callbackQueryDataPerion("March"),
-		},
-		{
-			Text:         "April",
-			CallbackData: callbackQueryDataPerion("April"),
-		},
-		{
-			Text:         "May",
-			CallbackData: callbackQueryDataPerion("May"),
-		},
-		{
-			Text:         "June",
-			CallbackData: callbackQueryDataPerion("June"),
-		},
-	}
-	months2 := []tgbotapi.InlineKeyboardButton{
-		{
-			Text:         "July",
-			CallbackData: callbackQueryDataPerion("July"),
-		},
-		{
-			Text:         "August",
-			CallbackData: callbackQueryDataPerion("August"),
-		},
-		{
-			Text:         "September",
-			CallbackData: callbackQueryDataPerion("September"),
-		},
-		{
-			Text:         "October",
-			CallbackData: callbackQueryDataPerion("October"),
-		},
-		{
-			Text:         "November",
-			CallbackData: callbackQueryDataPerion("November"),
-		},
-		{
-			Text:         "December",
-			CallbackData: callbackQueryDataPerion("December"),
-		},
-	}
-
-	month := time.Now().Month()
-	if int(month) < len(months) {
-		months = months[:month]
-	}
-	if int(month) > len(months2) {
-		months2 = months2[:month-6]
-	}
-
-	inlineKeyboardMarkup := tgbotapi.NewInlineKeyboardMarkup(custom, months, months2)
+		return tgbotapi.InlineKeyboardButton{
+			Text:         periodLabel(lang, period),
+			CallbackData: &d,
+		}
+	}
+
+	custom := []tgbotapi.InlineKeyboardButton{}
+	for _, period := range reportPeriods[:5] {
+		custom = append(custom, button(period))
+	}
+
+	// the months of the year until the current one
+	months := []tgbotapi.InlineKeyboardButton{}
+	months2 := []tgbotapi.InlineKeyboardButton{}
+	for i, period := range reportPeriods[5:] {
+		if i >= int(time.Now().Month()) {
+			break
+		}
+
+		if i < 6 {
+			months = append(months, button(period))
+		} else {
+			months2 = append(months2, button(period))
+		}
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{custom, months}
+	if len(months2) > 0 {
+		rows = append(rows, months2)
+	}
+
+	inlineKeyboardMarkup := tgbotapi.NewInlineKeyboardMarkup(rows...)
 
 	messageConfig := tgbotapi.EditMessageTextConfig{}
-	messageConfig.Text = "Виберіть період"
+	messageConfig.Text = T(lang, "choose_period")
 	messageConfig.ChatID = tgMessage.Chat.ID
 	messageConfig.MessageID = tgMessage.MessageID
 	messageConfig.ReplyMarkup = &inlineKeyboardMarkup
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func newTestReportUpdate(data string) tgbotapi.Update {
+	message := &tgbotapi.Message{
+		MessageID:      10,
+		Chat:           &tgbotapi.Chat{ID: 2},
+		ReplyToMessage: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 2}, From: &tgbotapi.User{ID: 2}},
+	}
+
+	return tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{Data: data, Message: message}}
+}
+
+func TestReportKeyboard(t *testing.T) {
+	r := NewReport("account", 1).(*report)
+
+	keyboard := r.reportKeyboard(12, 3, pageData{Session: "AAAAAAAA", Period: "Today"}, pageData{Session: "BBBBBBBB", Period: "Today"})
+	if len(keyboard.InlineKeyboard) != 2 || len(keyboard.InlineKeyboard[0]) != 2 {
+		t.Fatal("Expected 2 item buttons and the pages, got ", keyboard.InlineKeyboard)
+	}
+
+	// the buttons are numbered on the page, the data has the number in the period and the session of the items
+	button := keyboard.InlineKeyboard[0][1]
+	if button.Text != "2" || *button.CallbackData != "1:rd:BBBBBBBB:0:12" {
+		t.Error("Expected 2 and 1:rd:BBBBBBBB:0:12, got ", button.Text, *button.CallbackData)
+	}
+
+	if keyboard := r.reportKeyboard(0, 1, pageData{}, pageData{}); len(keyboard.InlineKeyboard) != 0 {
+		t.Error("Expected no buttons, got ", keyboard.InlineKeyboard)
+	}
+}
+
+func TestReportItemDetail(t *testing.T) {
+	r := NewReport("account", 1).(*report)
+
+	items := make([]StatementItem, 7)
+	items[5] = StatementItem{ID: "st6", Description: "Сільпо", Mcc: 5411, Amount: -100, Hold: true}
+	update := newTestReportUpdate("1:rp:AAAAAAAA:0:1")
+	r.SetGridData(update, items)
+
+	// the session has the ids of the 2nd page
+	data := pageData{Session: "AAAAAAAA", Period: "Today", Page: 6, Items: []string{"st6", "st7"}, Offset: 5}
+
+	tmpl, err := GetTempate(detailTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message, err := r.GetItemDetail(update, data, ReportView{Tmpl: tmpl, Lang: LangEN}, "Name", Account{CurrencyCode: 980})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"Сільпо", "MCC: 5411, Groceries", "Status: Pending"} {
+		if !strings.Contains(message.Text, expected) {
+			t.Errorf("Expected %q in %q", expected, message.Text)
+		}
+	}
+
+	// the back button opens the page of the item
+	keyboard := message.ReplyMarkup.InlineKeyboard
+	if back := *keyboard[0][0].CallbackData; back != "1:rr:AAAAAAAA:0:2" {
+		t.Error("Expected 1:rr:AAAAAAAA:0:2, got ", back)
+	}
+
+	// the number out of the session and the id out of the period are outdated
+	for _, page := range []int{5, 7, 8} {
+		data.Page = page
+		if _, err := r.GetItemDetail(update, data, ReportView{Tmpl: tmpl, Lang: LangEN}, "Name", Account{}); err != errCallbackOutdated {
+			t.Error("For", page, "expected errCallbackOutdated, got ", err)
+		}
+	}
+}
+
+func TestReportOutdatedPage(t *testing.T) {
+	r := NewReport("account", 1).(*report)
+	r.SetGridData(newTestReportUpdate("1:rp:AAAAAAAA:0:1"), make([]StatementItem, 7))
+
+	tmpl, err := GetTempate(reportPageTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 7 items are 2 pages, the buttons of the report with more items are outdated
+	for _, data := range []string{"1:rr:AAAAAAAA:0:0", "1:rr:AAAAAAAA:0:3"} {
+		if _, err := r.GetUpdatedReportGrid(newTestReportUpdate(data), ReportView{Tmpl: tmpl, Lang: LangEN}); err != errCallbackOutdated {
+			t.Error("For", data, "expected errCallbackOutdated, got ", err)
+		}
+	}
+
+	// the detail buttons of the page have the session with the ids of the items
+	var offset int
+	view := ReportView{Tmpl: tmpl, Lang: LangEN, Session: func(items []string, o int) (string, error) {
+		offset = o
+		return "BBBBBBBB", nil
+	}}
+	message, err := r.GetUpdatedReportGrid(newTestReportUpdate("1:rr:AAAAAAAA:0:2"), view)
+	if err != nil {
+		t.Fatal("Expected the last page, got ", err)
+	}
+
+	if button := message.ReplyMarkup.InlineKeyboard[0][0]; offset != 5 || *button.CallbackData != "1:rd:BBBBBBBB:0:6" {
+		t.Error("Expected the offset 5 and 1:rd:BBBBBBBB:0:6, got ", offset, *button.CallbackData)
+	}
+
+	// the empty report has the first page
+	if _, err := r.buildReportPage(nil, 1, 5, ""); err != nil {
+		t.Error("Expected the empty first page, got ", err)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// statementsBucket has the statement items received by the webhook and loaded by the reports
+	statementsBucket = "statements"
+
+	searchPerPage = 10
+)
+
+// storedStatement is the statement item with its client and account to search it
+type storedStatement struct {
+	ClientID     uint32        `json:"clientId"`
+	Account      string        `json:"account"`
+	CurrencyCode int           `json:"currencyCode"` // the currency of the account
+	Item         StatementItem `json:"item"`
+}
+
+// SearchResult is the found statement item with the name of its client
+type SearchResult struct {
+	Name          string
+	CurrencyCode  int // the currency of the account, the amount of the item is in it
+	StatementItem StatementItem
+}
+
+// SearchTotal is the sums of the found items in the currency of the accounts
+type SearchTotal struct {
+	CurrencyCode int `json:"currencyCode"`
+	Spent        int `json:"spent"`
+	Income       int `json:"income"`
+}
+
+// SearchPage is a structure to render the page of the search results
+type SearchPage struct {
+	Query   string
+	Total   int            // the number of the found items
+	Totals  []SearchTotal  // by the currency
+	Results []SearchResult // the results of the page
+	Offset  int            // the number of the results on the previous pages
+}
+
+// searchQuery is the parsed query of /search, the items have to match the text and all filters
+type searchQuery struct {
+	text    string
+	filters []func(item StatementItem) bool
+}
+
+// parseSearchQuery parses the words of the text and the filters in the location,
+// example: silpo amount>500 mcc:5411 from:2026-01-01 to:2026-01-31
+func parseSearchQuery(args []string, loc *time.Location) (searchQuery, error) {
+	query := searchQuery{}
+
+	words := []string{}
+	for _, arg := range args {
+		lower := strings.ToLower(arg)
+
+		switch {
+		case strings.HasPrefix(lower, "amount") && len(lower) > len("amount"):
+			filter, err := parseAmountFilter(lower[len("amount"):])
+			if err != nil {
+				return query, fmt.Errorf("incorrect filter %s", arg)
+			}
+			query.filters = append(query.filters, filter)
+		case strings.HasPrefix(lower, "mcc:"):
+			mcc, err := strconv.Atoi(lower[len("mcc:"):])
+			if err != nil {
+				return query, fmt.Errorf("incorrect filter %s", arg)
+			}
+			query.filters = append(query.filters, func(item StatementItem) bool { return item.Mcc == mcc })
+		case strings.HasPrefix(lower, "from:"):
+			from, err := time.ParseInLocation("2006-01-02", lower[len("from:"):], orDefaultLocation(loc))
+			if err != nil {
+				return query, fmt.Errorf("incorrect filter %s", arg)
+			}
+			query.filters = append(query.filters, func(item StatementItem) bool { return int64(item.Time) >= from.Unix() })
+		case strings.HasPrefix(lower, "to:"):
+			to, err := time.ParseInLocation("2006-01-02", lower[len("to:"):], orDefaultLocation(loc))
+			if err != nil {
+				return query, fmt.Errorf("incorrect filter %s", arg)
+			}
+			// the day is included
+			to = to.AddDate(0, 0, 1)
+			query.filters = append(query.filters, func(item StatementItem) bool { return int64(item.Time) < to.Unix() })
+		default:
+			words = append(words, lower)
+		}
+	}
+	query.text = strings.Join(words, " ")
+
+	if query.text == "" && len(query.filters) == 0 {
+		return query, fmt.Errorf("empty query")
+	}
+
+	return query, nil
+}
+
+// parseAmountFilter parses the comparison of the amount in the major units without the sign,
+// example: >500, <99.99, =100
+func parseAmountFilter(filter string) (func(item StatementItem) bool, error) {
+	if len(filter) < 2 {
+		return nil, fmt.Errorf("incorrect amount %s", filter)
+	}
+
+	value, err := strconv.ParseFloat(strings.ReplaceAll(filter[1:], ",", "."), 64)
+	if err != nil || value < 0 {
+		return nil, fmt.Errorf("incorrect amount %s", filter)
+	}
+	amount := int(math.Round(value * 100))
+
+	switch filter[0] {
+	case '>':
+		return func(item StatementItem) bool { return abs(item.Amount) > amount }, nil
+	case '<':
+		return func(item StatementItem) bool { return abs(item.Amount) < amount }, nil
+	case '=':
+		return func(item StatementItem) bool { return abs(item.Amount) == amount }, nil
+	}
+
+	return nil, fmt.Errorf("incorrect amount %s", filter)
+}
+
+// matchFilters checks the filters of the query
+func (q searchQuery) matchFilters(item StatementItem) bool {
+	for _, filter := range q.filters {
+		if !filter(item) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchText checks the text of the query in the description, the comment and the note of the item in any case
+func (q searchQuery) matchText(item StatementItem) bool {
+	if q.text == "" {
+		return true
+	}
+
+	for _, text := range []string{item.Description, item.Comment, item.Note} {
+		if strings.Contains(strings.ToLower(text), q.text) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// saveStatements saves the statement items of the account to search them, the items with the same id are replaced
+func (b *bot) saveStatements(client Client, account Account, items []StatementItem) error {
+	return b.storage.Update(func(tx StorageTx) error {
+		for _, item := range items {
+			statement := storedStatement{ClientID: client.GetID(), Account: account.ID, CurrencyCode: account.CurrencyCode, Item: item}
+			if err := tx.Put(statementsBucket, item.ID, statement); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// search returns the saved statement items of the query which the access can see, the newest first
+func (b *bot) search(grant AccessConfig, query searchQuery) ([]storedStatement, error) {
+	found := []storedStatement{}
+	err := b.storage.ForEach(statementsBucket, func(key string, value []byte) error {
+		var statement storedStatement
+		if err := json.Unmarshal(value, &statement); err != nil {
+			return nil
+		}
+
+		if !query.matchFilters(statement.Item) {
+			return nil
+		}
+
+		client, err := b.getClientByID(statement.ClientID)
+		if err != nil || !b.canSeeAccount(grant, client, statement.Account) {
+			return nil
+		}
+
+		found = append(found, statement)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the notes are in the annotations
+	categorize := b.clientsCategorizer()
+	matched := []storedStatement{}
+	for _, statement := range found {
+		items := []StatementItem{statement.Item}
+		b.annotateItems(items)
+		categorize(statement.ClientID, &items[0])
+		statement.Item = items[0]
+
+		if query.matchText(statement.Item) {
+			matched = append(matched, statement)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].Item.Time > matched[j].Item.Time })
+
+	return matched, nil
+}
+
+// searchTotals returns the sums of the found items by the currency
+func searchTotals(found []storedStatement) []SearchTotal {
+	totals := map[int]*SearchTotal{}
+	for _, statement := range found {
+		total, ok := totals[statement.CurrencyCode]
+		if !ok {
+			total = &SearchTotal{CurrencyCode: statement.CurrencyCode}
+			totals[statement.CurrencyCode] = total
+		}
+
+		if statement.Item.Amount < 0 {
+			total.Spent += -statement.Item.Amount
+		} else {
+			total.Income += statement.Item.Amount
+		}
+	}
+
+	result := []SearchTotal{}
+	for _, total := range totals {
+		result = append(result, *total)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CurrencyCode < result[j].CurrencyCode })
+
+	return result
+}
+
+// searchSession saves the ids and the totals of the found items, the pages are loaded by the ids
+func (b *bot) searchSession(query string, found []storedStatement) (pageData, error) {
+	session := callbackSession{Query: query, Totals: searchTotals(found)}
+	for _, statement := range found {
+		session.Results = append(session.Results, statement.Item.ID)
+	}
+
+	id, err := b.saveCallbackSession(session)
+
+	return pageData{Session: id, Query: query, Results: session.Results, Totals: session.Totals, Page: 1}, err
+}
+
+// buildSearchPage returns the page of the results of the session, the items are loaded by the ids of the page
+// and the access is checked again, the hidden items are skipped
+func (b *bot) buildSearchPage(grant AccessConfig, data pageData) (SearchPage, error) {
+	searchPage := SearchPage{Query: data.Query, Total: len(data.Results), Totals: data.Totals, Offset: (data.Page - 1) * searchPerPage}
+	if data.Page < 1 || searchPage.Offset >= len(data.Results) && data.Page != 1 {
+		return searchPage, errCallbackOutdated
+	}
+
+	categorize := b.clientsCategorizer()
+	for i := searchPage.Offset; i < len(data.Results) && i < data.Page*searchPerPage; i++ {
+		var statement storedStatement
+		ok, err := b.storage.Get(statementsBucket, data.Results[i], &statement)
+		if err != nil {
+			return searchPage, err
+		}
+
+		client, err := b.getClientByID(statement.ClientID)
+		if !ok || err != nil || !b.canSeeAccount(grant, client, statement.Account) {
+			continue
+		}
+
+		items := []StatementItem{statement.Item}
+		b.annotateItems(items)
+		categorize(statement.ClientID, &items[0])
+
+		searchPage.Results = append(searchPage.Results, SearchResult{Name: client.GetName(), CurrencyCode: statement.CurrencyCode, StatementItem: items[0]})
+	}
+
+	return searchPage, nil
+}
+
+// searchMessage returns the text and the buttons of the page of the search results
+func (b *bot) searchMessage(grant AccessConfig, chatID int64, lang Lang, data pageData) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	searchPage, err := b.buildSearchPage(grant, data)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	message, err := executeTemplate(b.getTemplate(searchTemplateName, nil, chatID), lang, b.timezone(chatID), searchPage)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
+	if pages := getPaginateButtons(len(data.Results), data.Page, searchPerPage, callbackQueryDataBuilder("sr", data)); len(pages) > 0 {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, pages)
+	}
+
+	return message, keyboard, nil
+}
+
+// editSearchPage shows the page of the search results saved in the session
+func (b *bot) editSearchPage(update tgbotapi.Update, grant AccessConfig, data pageData, lang Lang) {
+	chatID := update.CallbackQuery.Message.Chat.ID
+
+	message, keyboard, err := b.searchMessage(grant, chatID, lang, data)
+	if errors.Is(err, errCallbackOutdated) {
+		b.answerCallback(update.CallbackQuery, T(lang, "button_outdated"))
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("[search] search page")
+		b.answerCallback(update.CallbackQuery, T(lang, "error"))
+		return
+	}
+
+	editMessage := tgbotapi.NewEditMessageText(chatID, update.CallbackQuery.Message.MessageID, message)
+	editMessage.ParseMode = tgbotapi.ModeHTML
+	editMessage.ReplyMarkup = &keyboard
+
+	if _, err := b.send(editMessage); err != nil {
+		log.Error().Err(err).Msg("[search] send page")
+	}
+
+	b.answerCallback(update.CallbackQuery, "")
+}
+
+// cmdSearch searches the statement items of the visible clients and accounts,
+// example: /search silpo amount>500 mcc:5411 from:2026-01-01
+func (b *bot) cmdSearch(c commandContext) {
+	query := strings.Join(c.Args, " ")
+	parsed, err := parseSearchQuery(c.Args, b.timezone(c.Message.Chat.ID))
+	if err != nil {
+		b.reply(c.Message, T(c.Lang, "search_usage"))
+		return
+	}
+
+	found, err := b.search(c.Grant, parsed)
+	if err != nil {
+		log.Error().Err(err).Msg("[search] search")
+		b.reply(c.Message, T(c.Lang, "error"))
+		return
+	}
+
+	// the pages are of the results saved in the session of the buttons
+	data, err := b.searchSession(query, found)
+	if err != nil {
+		log.Error().Err(err).Msg("[search] callback session")
+		b.reply(c.Message, T(c.Lang, "error"))
+		return
+	}
+
+	message, keyboard, err := b.searchMessage(c.Grant, c.Message.Chat.ID, c.Lang, data)
+	if err != nil {
+		log.Error().Err(err).Msg("[search] search page")
+		b.reply(c.Message, T(c.Lang, "error"))
+		return
+	}
+
+	msg := htmlMessage(c.Message.Chat.ID, message)
+	if len(keyboard.InlineKeyboard) > 0 {
+		msg.ReplyMarkup = keyboard
+	}
+	b.replyMessage(c.Message, msg)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	kyiv, err := time.LoadLocation("Europe/Kiev")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	// 2026-01-01 00:30 in Kyiv
+	item := StatementItem{Description: "Сільпо", Comment: "Молоко", Mcc: 5411, Amount: -50050, Time: 1767220200}
+
+	var tests = []struct {
+		query    string
+		expected bool
+	}{
+		{"сільпо", true},
+		{"МОЛОКО amount>500", true},
+		{"amount>500.50", false},
+		{"amount<600 amount>500,49", true},
+		{"amount=500.5 mcc:5411", true},
+		{"mcc:5499", false},
+		{"from:2026-01-01", true},
+		{"to:2025-12-31", false},
+		{"atb", false},
+	}
+
+	for _, test := range tests {
+		query, err := parseSearchQuery(strings.Fields(test.query), kyiv)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if match := query.matchFilters(item) && query.matchText(item); match != test.expected {
+			t.Error("For", test.query, "expected", test.expected, "got", match)
+		}
+	}
+
+	for _, query := range []string{"", "amount>x", "amount~5", "mcc:x", "from:01.01.2026"} {
+		if _, err := parseSearchQuery(strings.Fields(query), kyiv); err == nil {
+			t.Error("Expected the error of", query)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	b := newTestInviteBot(t)
+
+	family := NewClient(ClientConfig{Alias: "family"})
+	personal := NewClient(ClientConfig{Alias: "personal"})
+	b.setClients([]Client{family, personal}, map[uint32]*clientSettings{family.GetID(): {}, personal.GetID(): {}})
+
+	err := b.saveStatements(family, Account{ID: "uah", CurrencyCode: 980}, []StatementItem{
+		{ID: "st1", Description: "Сільпо", Amount: -10000, Time: 1},
+		{ID: "st2", Description: "Переказ", Amount: 50000, Time: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.saveStatements(family, Account{ID: "usd", CurrencyCode: 840}, []StatementItem{{ID: "st3", Description: "Amazon", Amount: -2000, Time: 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.saveStatements(personal, Account{ID: "own", CurrencyCode: 980}, []StatementItem{{ID: "st4", Description: "Сільпо", Amount: -300, Time: 4}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the note of the annotation is searched as well
+	if err := b.storage.Put(annotationsBucket, "st3", Annotation{Note: "книга"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		grant    AccessConfig
+		query    string
+		expected []string
+	}{
+		{AccessConfig{Role: RoleOwner}, "сільпо", []string{"st4", "st1"}},
+		{AccessConfig{Role: RoleViewer, Clients: []string{"family"}}, "amount>0", []string{"st2", "st3", "st1"}},
+		{AccessConfig{Role: RoleViewer, Clients: []string{"family"}, Accounts: []string{"usd"}}, "книга", []string{"st3"}},
+		{AccessConfig{Role: RoleViewer, Clients: []string{"personal"}}, "amazon", []string{}},
+	}
+
+	for _, test := range tests {
+		query, err := parseSearchQuery(strings.Fields(test.query), time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found, err := b.search(test.grant, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := []string{}
+		for _, statement := range found {
+			ids = append(ids, statement.Item.ID)
+		}
+
+		if !reflect.DeepEqual(ids, test.expected) {
+			t.Error("For", test.query, "expected", test.expected, "got", ids)
+		}
+	}
+
+	// the totals are of all found items by the currency, the results are of the page
+	query, _ := parseSearchQuery([]string{"amount>0"}, time.UTC)
+	found, _ := b.search(AccessConfig{Role: RoleOwner}, query)
+
+	// 11 results of st4, st2, st3, st1, st4, st2, st3, st1, st4, st2, st3
+	results := append(append(append([]storedStatement{}, found...), found...), found[:3]...)
+	data, err := b.searchSession("amount>0", results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the pages are loaded from the session
+	data, err = b.parseCallback(callbackQueryDataBuilder("sr", data) + "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := b.buildSearchPage(AccessConfig{Role: RoleOwner}, data)
+	expected := []SearchTotal{{CurrencyCode: 840, Spent: 2000 * 3}, {CurrencyCode: 980, Spent: 10300*2 + 300, Income: 50000 * 3}}
+	if err != nil || len(page.Results) != 1 || page.Offset != 10 || page.Total != 11 || !reflect.DeepEqual(page.Totals, expected) {
+		t.Error("Expected the last result and the totals", expected, "got", page.Results, page.Offset, page.Totals, err)
+	}
+
+	// the access is checked again, st4 of the personal client is hidden
+	data.Page = 1
+	page, _ = b.buildSearchPage(AccessConfig{Role: RoleViewer, Clients: []string{"family"}}, data)
+	if len(page.Results) != 7 {
+		t.Error("Expected 7 results of the family client, got ", len(page.Results))
+	}
+
+	data.Page = 3
+	if _, err := b.buildSearchPage(AccessConfig{Role: RoleOwner}, data); err != errCallbackOutdated {
+		t.Error("Expected errCallbackOutdated, got ", err)
+	}
+}
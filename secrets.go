@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	stdlog "log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"golang.org/x/crypto/scrypt"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	secretsSaltSize = 16
+	secretsKeySize  = 32
+
+	// secrets shorter than that are not redacted to avoid masking of the regular words
+	redactMinLength = 6
+)
+
+// Secrets is a content of the encrypted secrets file
+type Secrets struct {
+	TelegramToken         string            `yaml:"telegram_token"`
+	TelegramWebhookSecret string            `yaml:"telegram_webhook_secret"`
+	WebhookSecret         string            `yaml:"webhook_secret"`
+	MQTTPassword          string            `yaml:"mqtt_password"`
+	UserTokensKey         string            `yaml:"user_tokens_key"`
+	MonoTokens            map[string]string `yaml:"mono_tokens"` // monobank tokens by the client alias
+}
+
+// getEnvSecret returns a value of the environment variable, the value is read from the file
+// of the <key>_FILE variable if it is set, example: TELEGRAM_TOKEN_FILE=/run/secrets/telegram_token
+func getEnvSecret(key string) (string, error) {
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return os.Getenv(key), nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s_FILE: %w", key, err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// LoadSecrets decrypts and parses the secrets file
+func LoadSecrets(path, passphrase string) (Secrets, error) {
+	secrets := Secrets{}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return secrets, err
+	}
+
+	data, err = DecryptSecrets(data, passphrase)
+	if err != nil {
+		return secrets, fmt.Errorf("secrets %s: %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(data, &secrets); err != nil {
+		return secrets, fmt.Errorf("secrets %s: %w", path, err)
+	}
+
+	return secrets, nil
+}
+
+// EncryptSecrets encrypts the data with AES-GCM using a key derived from the passphrase by scrypt,
+// the result is base64 of the salt, the nonce and the ciphertext.
+func EncryptSecrets(data []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, secretsSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := secretsCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := append(append(salt, nonce...), aead.Seal(nil, nonce, data, nil)...)
+
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(sealed)))
+	base64.StdEncoding.Encode(encoded, sealed)
+
+	return append(encoded, '\n'), nil
+}
+
+// DecryptSecrets decrypts the data encrypted by EncryptSecrets
+func DecryptSecrets(data []byte, passphrase string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < secretsSaltSize {
+		return nil, errors.New("incorrect format")
+	}
+
+	aead, err := secretsCipher(passphrase, sealed[:secretsSaltSize])
+	if err != nil {
+		return nil, err
+	}
+
+	sealed = sealed[secretsSaltSize:]
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("incorrect format")
+	}
+
+	data, err = aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("incorrect passphrase or the file is damaged")
+	}
+
+	return data, nil
+}
+
+func secretsCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, errors.New("empty passphrase")
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, secretsKeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// apply sets the secrets to the config, the values of the secrets file take precedence
+func (s Secrets) apply(config *Config) {
+	setIfNotEmpty := func(value *string, secret string) {
+		if secret != "" {
+			*value = secret
+		}
+	}
+
+	setIfNotEmpty(&config.TelegramToken, s.TelegramToken)
+	setIfNotEmpty(&config.TelegramWebhookSecret, s.TelegramWebhookSecret)
+	setIfNotEmpty(&config.WebhookSecret, s.WebhookSecret)
+	setIfNotEmpty(&config.MQTT.Password, s.MQTTPassword)
+	setIfNotEmpty(&config.UserTokensKey, s.UserTokensKey)
+
+	if len(s.MonoTokens) == 0 {
+		return
+	}
+
+	// the configured clients get tokens by the alias, otherwise the clients are created from the secrets
+	if len(config.Clients) > 0 {
+		for i, client := range config.Clients {
+			if token, ok := s.MonoTokens[client.Alias]; ok && client.Token == "" {
+				config.Clients[i].Token = token
+			}
+		}
+		return
+	}
+
+	aliases := make([]string, 0, len(s.MonoTokens))
+	for alias := range s.MonoTokens {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	for _, alias := range aliases {
+		config.Clients = append(config.Clients, ClientConfig{Alias: alias, Token: s.MonoTokens[alias]})
+	}
+}
+
+// redactor is a log writer which replaces the secrets with ***
+type redactor struct {
+	mu      sync.RWMutex
+	out     io.Writer
+	secrets []string
+}
+
+// logRedactor is the output of the logger, the loaded secrets are added to it
+var logRedactor = &redactor{out: os.Stderr}
+
+// newTelegramLogger returns the logger of the telegram library writing through the redactor,
+// the errors of the library have the urls with the token
+func newTelegramLogger(r *redactor) tgbotapi.BotLogger {
+	return stdlog.New(r, "[telegram] ", stdlog.LstdFlags)
+}
+
+// Add adds the secrets to redact
+func (r *redactor) Add(secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, secret := range secrets {
+		if len(secret) < redactMinLength || contains(r.secrets, secret) {
+			continue
+		}
+
+		r.secrets = append(r.secrets, secret)
+	}
+
+	// the longest first, a secret may contain another one
+	sort.Slice(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+}
+
+// Redact replaces the secrets in the string
+func (r *redactor) Redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, "***")
+	}
+
+	return s
+}
+
+func (r *redactor) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.out, r.Redact(string(p))); err != nil {
+		return 0, err
+	}
+
+	// the length of the original data, the logger treats a shorter one as an error
+	return len(p), nil
+}
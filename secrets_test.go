@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptSecrets(t *testing.T) {
+	data := []byte("telegram_token: token\n")
+
+	encrypted, err := EncryptSecrets(data, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(encrypted, []byte("token")) {
+		t.Error("Expected encrypted data, got ", string(encrypted))
+	}
+
+	decrypted, err := DecryptSecrets(encrypted, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decrypted, data) {
+		t.Error("Expected ", string(data), ", got ", string(decrypted))
+	}
+
+	if _, err := DecryptSecrets(encrypted, "incorrect"); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+func TestLoadConfigSecrets(t *testing.T) {
+	dir := t.TempDir()
+
+	encrypted, err := EncryptSecrets([]byte("telegram_token: telegram\nmono_tokens:\n  personal: token1\n"), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secretsPath := filepath.Join(dir, "secrets.enc")
+	passphrasePath := filepath.Join(dir, "passphrase")
+	tokensPath := filepath.Join(dir, "tokens")
+
+	for path, data := range map[string]string{
+		secretsPath:    string(encrypted),
+		passphrasePath: "passphrase\n",
+		tokensPath:     "token2\ntoken3\n",
+	} {
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("MONO_TOKENS_FILE", tokensPath)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if clients := config.ClientConfigs(); len(clients) != 2 || clients[1].Token != "token3" {
+		t.Error("Expected token2 and token3, got ", clients)
+	}
+
+	t.Setenv("MONO_TOKENS_FILE", "")
+	t.Setenv("SECRETS_FILE", secretsPath)
+	t.Setenv("SECRETS_PASSPHRASE_FILE", passphrasePath)
+
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.TelegramToken != "telegram" {
+		t.Error("Expected telegram, got ", config.TelegramToken)
+	}
+
+	if clients := config.ClientConfigs(); len(clients) != 1 || clients[0].Alias != "personal" || clients[0].Token != "token1" {
+		t.Error("Expected personal client, got ", clients)
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	var out bytes.Buffer
+	r := &redactor{out: &out}
+	r.Add("secret-token", "short", "secret-token-long")
+
+	var tests = []struct {
+		input    string
+		expected string
+	}{
+		{"url /botsecret-token/getMe", "url /bot***/getMe"},
+		{"secret-token-long", "***"},
+		{"short", "short"},
+	}
+
+	for _, test := range tests {
+		out.Reset()
+
+		n, err := r.Write([]byte(test.input))
+		if err != nil || n != len(test.input) {
+			t.Error("Expected ", len(test.input), ", got ", n, err)
+		}
+
+		if out.String() != test.expected {
+			t.Error("Expected ", test.expected, ", got ", out.String())
+		}
+	}
+}
+
+func TestTelegramLogger(t *testing.T) {
+	var out bytes.Buffer
+	r := &redactor{out: &out}
+	r.Add("123456:secret-token")
+
+	// the poller of the library logs the errors of getUpdates with the url
+	logger := newTelegramLogger(r)
+	logger.Println(errors.New(`Post "https://api.telegram.org/bot123456:secret-token/getUpdates": dial tcp: i/o timeout`))
+
+	if strings.Contains(out.String(), "secret-token") || !strings.Contains(out.String(), "/bot***/getUpdates") {
+		t.Error("Expected the redacted token, got ", out.String())
+	}
+}
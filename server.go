@@ -0,0 +1,261 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// newHTTPServer returns a http server configured with timeouts and TLS
+func newHTTPServer(config HTTPConfig, handler http.Handler) (*http.Server, error) {
+	server := &http.Server{
+		Addr:              config.Addr,
+		Handler:           handler,
+		ReadTimeout:       config.ReadTimeout,
+		ReadHeaderTimeout: config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+
+	if config.TLSSelfSigned && config.TLSCertFile == "" {
+		certificate, err := selfSignedCertificate(config.Addr)
+		if err != nil {
+			return nil, err
+		}
+
+		server.TLSConfig = &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{certificate},
+		}
+	} else if config.TLSCertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		server.TLSConfig = &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{certificate},
+		}
+	}
+
+	return server, nil
+}
+
+// serve serves the listener with TLS if it is configured
+func serve(server *http.Server, listener net.Listener) error {
+	if server.TLSConfig != nil {
+		return server.ServeTLS(listener, "", "")
+	}
+
+	return server.Serve(listener)
+}
+
+// healthURL returns the local url of the liveness probe of the server,
+// the server listening on all interfaces is checked on the loopback
+func healthURL(config HTTPConfig) (string, error) {
+	host, port, err := net.SplitHostPort(config.Addr)
+	if err != nil {
+		return "", err
+	}
+
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+
+	scheme := "http"
+	if config.TLSSelfSigned || config.TLSCertFile != "" {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s/healthz", scheme, net.JoinHostPort(host, port)), nil
+}
+
+// checkHealth requests the liveness probe of the server, the certificate is not verified on the local address
+func checkHealth(config HTTPConfig) error {
+	url, err := healthURL(config)
+	if err != nil {
+		return err
+	}
+
+	client := http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: status %d", url, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// selfSignedCertificate generates a certificate for the local testing
+func selfSignedCertificate(addr string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{Organization: []string{"mono_personal_tgbot"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	if host, _, err := net.SplitHostPort(addr); err == nil && host != "" {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, nil
+}
+
+// parseTrustedProxies parses the comma separated IPs or CIDRs of the trusted reverse proxies
+func parseTrustedProxies(proxies string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, proxy := range strings.Split(proxies, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, err
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// clientIP returns a real IP of the client, proxy headers are used only if the request is from a trusted proxy
+func clientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+
+	isTrusted := func(ip string) bool {
+		parsed := net.ParseIP(strings.TrimSpace(ip))
+		if parsed == nil {
+			return false
+		}
+
+		for _, network := range trustedProxies {
+			if network.Contains(parsed) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if !isTrusted(remoteIP) {
+		return remoteIP
+	}
+
+	// the rightmost address which is not a trusted proxy is the client
+	if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+		ips := strings.Split(forwardedFor, ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(ips[i])
+			if !isTrusted(ip) {
+				return ip
+			}
+		}
+	}
+
+	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		return strings.TrimSpace(realIP)
+	}
+
+	return remoteIP
+}
+
+// statusRecorder is a response writer to remember the status code
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs requests with the real IP of the client, the secrets are removed from the path
+func logRequests(handler http.Handler, trustedProxies []*net.IPNet, secrets ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		startedAt := time.Now()
+
+		handler.ServeHTTP(recorder, r)
+
+		path := r.URL.Path
+		for _, secret := range secrets {
+			if secret != "" {
+				path = strings.ReplaceAll(path, secret, "***")
+			}
+		}
+
+		log.Debug().
+			Str("ip", clientIP(r, trustedProxies)).
+			Str("method", r.Method).
+			Str("path", path).
+			Int("status", recorder.status).
+			Dur("duration", time.Since(startedAt)).
+			Msg("[http] request")
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trustedProxies, err := parseTrustedProxies("127.0.0.1, 10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		remoteAddr   string
+		forwardedFor string
+		realIP       string
+		expected     string
+	}{
+		{"1.2.3.4:1234", "5.6.7.8", "", "1.2.3.4"},
+		{"127.0.0.1:1234", "5.6.7.8", "", "5.6.7.8"},
+		{"127.0.0.1:1234", "9.9.9.9, 5.6.7.8, 10.0.0.2", "", "5.6.7.8"},
+		{"10.1.1.1:1234", "", "5.6.7.8", "5.6.7.8"},
+		{"10.1.1.1:1234", "", "", "10.1.1.1"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", test.forwardedFor)
+		}
+		if test.realIP != "" {
+			r.Header.Set("X-Real-IP", test.realIP)
+		}
+
+		if ip := clientIP(r, trustedProxies); ip != test.expected {
+			t.Error("remote", test.remoteAddr, "expected", test.expected, "got", ip)
+		}
+	}
+}
+
+func TestParseTrustedProxiesIncorrect(t *testing.T) {
+	if _, err := parseTrustedProxies("10.0.0.0/99"); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestNewHTTPServerSelfSigned(t *testing.T) {
+	server, err := newHTTPServer(HTTPConfig{Addr: "127.0.0.1:8443", TLSSelfSigned: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server.TLSConfig == nil || len(server.TLSConfig.Certificates) != 1 {
+		t.Error("Expected self-signed certificate")
+	}
+}
+
+func TestHealthURL(t *testing.T) {
+	var tests = []struct {
+		config   HTTPConfig
+		expected string
+	}{
+		{HTTPConfig{Addr: ":8080"}, "http://127.0.0.1:8080/healthz"},
+		{HTTPConfig{Addr: "0.0.0.0:9000", TLSSelfSigned: true}, "https://127.0.0.1:9000/healthz"},
+		{HTTPConfig{Addr: "[::]:8443", TLSCertFile: "cert.pem"}, "https://127.0.0.1:8443/healthz"},
+		{HTTPConfig{Addr: "localhost:8080"}, "http://localhost:8080/healthz"},
+	}
+
+	for _, test := range tests {
+		if url, err := healthURL(test.config); url != test.expected || err != nil {
+			t.Error("Expected", test.expected, "got", url, err)
+		}
+	}
+
+	if _, err := healthURL(HTTPConfig{Addr: "8080"}); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	config := HTTPConfig{Addr: server.Listener.Addr().String(), TLSSelfSigned: true}
+	if err := checkHealth(config); err != nil {
+		t.Error("Expected the healthy server, got ", err)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := checkHealth(config); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
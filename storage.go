@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Storage is the interface representing persistent key-value storage, values are stored as json.
+type Storage interface {
+	Get(bucket, key string, value interface{}) (bool, error)
+	Put(bucket, key string, value interface{}) error
+	Delete(bucket, key string) error
+	ForEach(bucket string, fn func(key string, value []byte) error) error
+	Update(fn func(tx StorageTx) error) error
+	Close() error
+}
+
+// StorageTx is the interface representing read-write transaction of the storage.
+type StorageTx interface {
+	Get(bucket, key string, value interface{}) (bool, error)
+	Put(bucket, key string, value interface{}) error
+	Delete(bucket, key string) error
+	ForEach(bucket string, fn func(key string, value []byte) error) error
+	NextSequence(bucket string) (uint64, error)
+}
+
+type storage struct {
+	db *bolt.DB
+}
+
+type storageTx struct {
+	tx *bolt.Tx
+}
+
+// NewStorage returns a storage object, the database file is created if it does not exist.
+func NewStorage(path string) (Storage, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	return &storage{db: db}, nil
+}
+
+func (s *storage) Get(bucket, key string, value interface{}) (bool, error) {
+	var ok bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		ok, err = storageTx{tx}.Get(bucket, key, value)
+		return err
+	})
+
+	return ok, err
+}
+
+func (s *storage) Put(bucket, key string, value interface{}) error {
+	return s.Update(func(tx StorageTx) error {
+		return tx.Put(bucket, key, value)
+	})
+}
+
+func (s *storage) Delete(bucket, key string) error {
+	return s.Update(func(tx StorageTx) error {
+		return tx.Delete(bucket, key)
+	})
+}
+
+func (s *storage) ForEach(bucket string, fn func(key string, value []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return storageTx{tx}.ForEach(bucket, fn)
+	})
+}
+
+func (s *storage) Update(fn func(tx StorageTx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(storageTx{tx})
+	})
+}
+
+func (s *storage) Close() error {
+	return s.db.Close()
+}
+
+func (t storageTx) Get(bucket, key string, value interface{}) (bool, error) {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return false, nil
+	}
+
+	data := b.Get([]byte(key))
+	if data == nil {
+		return false, nil
+	}
+
+	return true, json.Unmarshal(data, value)
+}
+
+func (t storageTx) Put(bucket, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	b, err := t.tx.CreateBucketIfNotExists([]byte(bucket))
+	if err != nil {
+		return err
+	}
+
+	return b.Put([]byte(key), data)
+}
+
+func (t storageTx) Delete(bucket, key string) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+
+	return b.Delete([]byte(key))
+}
+
+// ForEach iterates over the bucket in the key order
+func (t storageTx) ForEach(bucket string, fn func(key string, value []byte) error) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+
+	return b.ForEach(func(k, v []byte) error {
+		return fn(string(k), v)
+	})
+}
+
+func (t storageTx) NextSequence(bucket string) (uint64, error) {
+	if !t.tx.Writable() {
+		return 0, bolt.ErrTxNotWritable
+	}
+
+	b, err := t.tx.CreateBucketIfNotExists([]byte(bucket))
+	if err != nil {
+		return 0, err
+	}
+
+	return b.NextSequence()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	supervisorMinBackoff = time.Second
+	supervisorMaxBackoff = time.Minute
+)
+
+// supervise runs the subsystem and restarts it with backoff when it fails or panics, until the context is done.
+func supervise(ctx context.Context, h *health, name string, run func(ctx context.Context) error) {
+	backoff := supervisorMinBackoff
+
+	for {
+		startedAt := time.Now()
+
+		err := runSafe(ctx, run)
+		if ctx.Err() != nil {
+			if err != nil {
+				log.Error().Err(err).Msgf("[supervisor] %s stopped with error", name)
+			}
+
+			log.Info().Msgf("[supervisor] %s stopped", name)
+			return
+		}
+
+		if err == nil {
+			err = fmt.Errorf("%s stopped unexpectedly", name)
+		}
+
+		h.Down(name, err)
+
+		// the subsystem worked for a while, so it is a new failure
+		if time.Since(startedAt) > supervisorMaxBackoff {
+			backoff = supervisorMinBackoff
+		}
+
+		log.Error().Err(err).Msgf("[supervisor] %s failed, restart in %s", name, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > supervisorMaxBackoff {
+			backoff = supervisorMaxBackoff
+		}
+	}
+}
+
+// runSafe runs the function and converts a panic to an error
+func runSafe(ctx context.Context, run func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return run(ctx)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSuperviseRestartsAfterPanic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h := newHealth("worker")
+
+	runs := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		supervise(ctx, h, "worker", func(ctx context.Context) error {
+			runs++
+			if runs == 1 {
+				panic("boom")
+			}
+
+			h.Up("worker")
+			cancel()
+			<-ctx.Done()
+			return nil
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected supervise to stop")
+	}
+
+	if runs != 2 {
+		t.Error("Expected 2, got ", runs)
+	}
+	if status := h.Get()["worker"]; status.Status != statusUp {
+		t.Error("Expected up, got ", status.Status)
+	}
+}
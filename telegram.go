@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	telegramDefaultWebhookPath = "/telegram_hook"
+	telegramSecretHeader       = "X-Telegram-Bot-Api-Secret-Token"
+	telegramMaxBodySize        = 1 << 20
+)
+
+// telegramWebhookPath returns a path of the telegram webhook on the http server
+func (b *bot) telegramWebhookPath() string {
+	u, err := url.Parse(b.telegramWebhookURL)
+	if err != nil || u.Path == "" || u.Path == "/" {
+		return telegramDefaultWebhookPath
+	}
+
+	return u.Path
+}
+
+// setTelegramWebhook registers the webhook with the secret token, telegram sends the token in every request.
+func (b *bot) setTelegramWebhook() error {
+	webhookURL, err := url.Parse(b.telegramWebhookURL)
+	if err != nil {
+		return err
+	}
+	webhookURL.Path = b.telegramWebhookPath()
+
+	params := url.Values{}
+	params.Set("url", webhookURL.String())
+	params.Set("secret_token", b.telegramWebhookSecret)
+	params.Set("allowed_updates", `["message","callback_query"]`)
+
+	response, err := b.getBotAPI().MakeRequest("setWebhook", params)
+	if err != nil {
+		return err
+	}
+
+	if !response.Ok {
+		return errors.New(response.Description)
+	}
+
+	log.Info().Msgf("[telegram] webhook is set, path %s", webhookURL.Path)
+	return nil
+}
+
+// handleTelegramWebhook handles updates sent by telegram to the webhook
+func (b *bot) handleTelegramWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	secret := r.Header.Get(telegramSecretHeader)
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(b.telegramWebhookSecret)) != 1 {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+
+		log.Warn().Msg("[telegram] webhook, incorrect secret token")
+		return
+	}
+
+	var update tgbotapi.Update
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, telegramMaxBodySize)).Decode(&update); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+
+		log.Error().Err(err).Msg("[telegram] webhook, decode update")
+		return
+	}
+
+	select {
+	case b.telegramUpdates <- update:
+	case <-r.Context().Done():
+		// telegram retries the update on error
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+	}
+}
+
+// randomSecret returns a random hex string to use as a secret
+func randomSecret() string {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		log.Fatal().Err(err).Msg("[secret] random")
+	}
+
+	return hex.EncodeToString(data)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestTelegramWebhookHandler(t *testing.T) {
+	b := &bot{
+		telegramWebhookURL:    "https://example.com/tg",
+		telegramWebhookSecret: "s3cret",
+		telegramUpdates:       make(chan tgbotapi.Update, 1),
+	}
+
+	if path := b.telegramWebhookPath(); path != "/tg" {
+		t.Error("Expected /tg, got ", path)
+	}
+
+	var tests = []struct {
+		secret   string
+		expected int
+	}{
+		{"", http.StatusForbidden},
+		{"wrong", http.StatusForbidden},
+		{"s3cret", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/tg", strings.NewReader(`{"update_id":1,"message":{"text":"/balance"}}`))
+		req.Header.Set(telegramSecretHeader, test.secret)
+		w := httptest.NewRecorder()
+
+		b.handleTelegramWebhook(w, req)
+
+		if w.Code != test.expected {
+			t.Error("secret", test.secret, "expected", test.expected, "got", w.Code)
+		}
+	}
+
+	update := <-b.telegramUpdates
+	if update.UpdateID != 1 || update.Message.Text != "/balance" {
+		t.Error("Unexpected update ", update)
+	}
+}
+
+// fakeTelegram is the transport of the telegram api recording the requested methods
+type fakeTelegram struct {
+	mu        sync.Mutex
+	methods   []string
+	params    []url.Values
+	responses map[string]string // the responses of the methods, ok with an empty result by default
+}
+
+func (f *fakeTelegram) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.ParseForm()
+	method := path.Base(req.URL.Path)
+
+	f.mu.Lock()
+	f.methods = append(f.methods, method)
+	f.params = append(f.params, req.PostForm)
+	response, ok := f.responses[method]
+	f.mu.Unlock()
+
+	if !ok {
+		response = `{"ok":true,"result":{}}`
+	}
+
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(response))}, nil
+}
+
+// newTestTelegram sets the telegram bot of the fake api
+func newTestTelegram(b *bot) *fakeTelegram {
+	f := &fakeTelegram{responses: map[string]string{}}
+	b.botAPI = &tgbotapi.BotAPI{Token: "token", Client: &http.Client{Transport: f}}
+
+	return f
+}
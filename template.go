@@ -1,37 +1,75 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"html"
 	"html/template"
+	"strings"
+	"time"
 )
 
-// Statement template, use the StatementItem structure and Name field
-var statementTemplate = ` {{ .Name }}
-{{ getIcon .StatementItem }} {{ normalizePrice .StatementItem.Amount }}{{ getCurrencySymbol .Account.CurrencyCode }}{{ if ne .StatementItem.Amount .StatementItem.OperationAmount }} ({{ normalizePrice .StatementItem.OperationAmount }}{{ getCurrencySymbol .StatementItem.CurrencyCode }}){{end}}{{if .StatementItem.CashbackAmount }}, Кешбек: {{ normalizePrice .StatementItem.CashbackAmount }}{{ getCurrencySymbol .StatementItem.CurrencyCode }}{{end}}
-{{ unescapeString .StatementItem.Description }}{{if .StatementItem.Comment }}
-Коментар: {{ unescapeString .StatementItem.Comment }}{{end}}
-Баланс: {{ normalizePrice .StatementItem.Balance }}{{ getCurrencySymbol .Account.CurrencyCode }}`
+// Statement template, use the StatementMessage structure, the templates are rendered as telegram HTML
+var statementTemplate = `<b>{{ .Name }}</b>, {{ time .StatementItem.Time }}
+{{ getIcon .StatementItem }} <b>{{ normalizePrice .StatementItem.Amount }}{{ getCurrencySymbol .Account.CurrencyCode }}</b>{{ if ne .StatementItem.Amount .StatementItem.OperationAmount }} ({{ normalizePrice .StatementItem.OperationAmount }}{{ getCurrencySymbol .StatementItem.CurrencyCode }}){{end}}{{if .StatementItem.CashbackAmount }}, {{ t "cashback" }}: {{ normalizePrice .StatementItem.CashbackAmount }}{{ getCurrencySymbol .StatementItem.CurrencyCode }}{{end}}
+{{ .StatementItem.Description }}{{if .StatementItem.Comment }}
+{{ t "comment" }}: <i>{{ .StatementItem.Comment }}</i>{{end}}
+{{ t "balance" }}: <code>{{ normalizePrice .StatementItem.Balance }}{{ getCurrencySymbol .Account.CurrencyCode }}</code>`
 
-// Balance template, use the Account structure
-var balanceTemplate = `{{ .Name }}
+// Balance template, use the ClientInfo structure, the IBAN in the code entity is copied by a tap
+var balanceTemplate = `<b>{{ .Name }}</b>
 
-{{range $item := .Accounts }}- {{ .Type }}
-Баланс: {{ normalizePrice $item.Balance }}{{ getCurrencySymbol $item.CurrencyCode }}
+{{range $item := .Accounts }}- {{ .Type }}{{ if .MaskedPan }} {{ maskPan .MaskedPan }}{{end}}
+{{ t "balance" }}: <code>{{ normalizePrice $item.Balance }}{{ getCurrencySymbol $item.CurrencyCode }}</code>{{ if .Iban }}
+IBAN: <code>{{ .Iban }}</code>{{end}}
 {{end}}`
 
-// Report template, Use the ReportPage structure
-var reportPageTemplate = `Витрачено: {{ normalizePrice .SpentTotal }}{{ getCurrencySymbol .CurrencyCode }}, Кешбек: {{ normalizePrice .CashbackAmountTotal }}{{ getCurrencySymbol .CurrencyCode }}
+// Report template, Use the ReportPage structure, the items of a day follow its separator,
+// the numbers of the items are the numbers of the detail buttons
+var reportPageTemplate = `{{ if .Tag }}#{{ .Tag }}
+{{ end }}{{ t "spent" }}: <b>{{ normalizePrice .SpentTotal }}{{ getCurrencySymbol .CurrencyCode }}</b>, {{ t "cashback" }}: {{ normalizePrice .CashbackAmountTotal }}{{ getCurrencySymbol .CurrencyCode }}
 
-{{range $item := .StatementItems }}{{ getIcon $item }} {{ normalizePrice $item.Amount }}{{ getCurrencySymbol .CurrencyCode }} {{ if ne $item.Amount $item.OperationAmount }} ({{ normalizePrice $item.OperationAmount }}{{ getCurrencySymbol $item.CurrencyCode }}){{end}}{{if $item.CashbackAmount }}, Кешбек: {{ normalizePrice $item.CashbackAmount }}{{ getCurrencySymbol $item.CurrencyCode }}{{end}}
-{{ unescapeString $item.Description }}{{if $item.Comment }}
-Коментар: {{ unescapeString $item.Comment }}{{end}}
-Баланс: {{ normalizePrice $item.Balance }}{{ getCurrencySymbol $item.CurrencyCode }}
+{{ $day := "" }}{{range $i, $item := .StatementItems }}{{ if ne (day $item.Time) $day }}{{ $day = day $item.Time }}— {{ $day }} —
+{{end}}{{ add $i 1 }}. {{ relative $item.Time }} {{ getIcon $item }} <b>{{ normalizePrice $item.Amount }}{{ getCurrencySymbol .CurrencyCode }}</b> {{ if ne $item.Amount $item.OperationAmount }} ({{ normalizePrice $item.OperationAmount }}{{ getCurrencySymbol $item.CurrencyCode }}){{end}}{{if $item.CashbackAmount }}, {{ t "cashback" }}: {{ normalizePrice $item.CashbackAmount }}{{ getCurrencySymbol $item.CurrencyCode }}{{end}}
+{{ $item.Description }}{{ if $item.Receipts }} 📎{{end}}{{if $item.Comment }}
+{{ t "comment" }}: <i>{{ $item.Comment }}</i>{{end}}{{if $item.Note }}
+📝 <i>{{ $item.Note }}</i>{{end}}{{if $item.Tags }}
+{{ tags $item.Tags }}{{end}}
+{{ t "balance" }}: <code>{{ normalizePrice $item.Balance }}{{ getCurrencySymbol $item.CurrencyCode }}</code>
+
+{{end}}`
+
+// Detail template of the report item, use the StatementMessage structure
+var detailTemplate = `<b>{{ .Name }}</b>
+{{ getIcon .StatementItem }} <b>{{ normalizePrice .StatementItem.Amount }}{{ getCurrencySymbol .Account.CurrencyCode }}</b>
+{{ .StatementItem.Description }}{{ if .StatementItem.Receipts }} 📎 {{ .StatementItem.Receipts }}{{end}}{{if .StatementItem.Comment }}
+{{ t "comment" }}: <i>{{ .StatementItem.Comment }}</i>{{end}}{{if .StatementItem.Note }}
+📝 <i>{{ .StatementItem.Note }}</i>{{end}}{{if .StatementItem.Tags }}
+{{ tags .StatementItem.Tags }}{{end}}
+
+{{ t "detail.time" }}: {{ date .StatementItem.Time "02.01.2006 15:04:05" }}
+{{ t "detail.category" }}: {{ itemCategory .StatementItem }}
+MCC: {{ .StatementItem.Mcc }}, {{ category .StatementItem.Mcc }}{{ if and .StatementItem.OriginalMcc (ne .StatementItem.OriginalMcc .StatementItem.Mcc) }}
+{{ t "detail.original_mcc" }}: {{ .StatementItem.OriginalMcc }}, {{ category .StatementItem.OriginalMcc }}{{end}}
+{{ t "detail.operation_amount" }}: {{ normalizePrice .StatementItem.OperationAmount }}{{ getCurrencySymbol .StatementItem.CurrencyCode }}
+{{ t "detail.commission" }}: {{ normalizePrice .StatementItem.CommissionRate }}{{ getCurrencySymbol .Account.CurrencyCode }}
+{{ t "cashback" }}: {{ normalizePrice .StatementItem.CashbackAmount }}{{ getCurrencySymbol .Account.CurrencyCode }}
+{{ t "detail.status" }}: {{ if .StatementItem.Hold }}{{ t "detail.hold" }}{{ else }}{{ t "detail.completed" }}{{ end }}
+{{ t "balance" }}: <code>{{ normalizePrice .StatementItem.Balance }}{{ getCurrencySymbol .Account.CurrencyCode }}</code>`
+
+// Search template, use the SearchPage structure, the totals are of all found items by the currency
+var searchTemplate = `🔍 <b>{{ .Query }}</b>
+{{ t "search_found" .Total }}{{ range .Totals }}
+{{ t "spent" }}: <b>{{ normalizePrice .Spent }}{{ getCurrencySymbol .CurrencyCode }}</b>, {{ t "income" }}: <b>{{ normalizePrice .Income }}{{ getCurrencySymbol .CurrencyCode }}</b>{{end}}
+
+{{range $i, $result := .Results }}{{ add (add $i $.Offset) 1 }}. {{ date $result.StatementItem.Time "02.01.2006 15:04" }} {{ getIcon $result.StatementItem }} <b>{{ normalizePrice $result.StatementItem.Amount }}{{ getCurrencySymbol $result.CurrencyCode }}</b>
+{{ $result.StatementItem.Description }}, {{ $result.Name }}{{if $result.StatementItem.Note }}
+📝 <i>{{ $result.StatementItem.Note }}</i>{{end}}
 
 {{end}}`
 
 // WebHook template, use the ClientInfo structure
-var webhookTemplate = `Вебхук: {{if .WebHookURL }}{{ .WebHookURL }}{{else}} Відсутній {{end}}`
+var webhookTemplate = `{{ t "webhook" }}: {{if .WebHookURL }}<code>{{ .WebHookURL }}</code>{{else}} {{ t "webhook_missing" }} {{end}}`
 
 // mccIconMap is map to help converting MMC code to emoji
 // see https://mcc.in.ua/ to explain a code
@@ -50,6 +88,28 @@ var mccIconMap = map[int]string{
 	5912: "💊",
 }
 
+// mccCategoryMap is map to help converting MCC code to the category of the catalog
+var mccCategoryMap = map[int]string{
+	5411: "groceries",
+	5499: "groceries",
+	5812: "restaurants",
+	5814: "restaurants",
+	5651: "clothes",
+	5655: "sport",
+	6011: "cash",
+	4814: "mobile",
+	4829: "transfers",
+	4111: "transport",
+	4121: "transport",
+	5541: "fuel",
+	5542: "fuel",
+	5912: "pharmacy",
+	5977: "beauty",
+	2842: "household",
+	7399: "services",
+	8999: "services",
+}
+
 // currencySymbolMap is map to help converting currency code to Symbol
 var currencySymbolMap = map[int]string{
 	980: "₴",
@@ -62,17 +122,59 @@ var currencySymbolMap = map[int]string{
 // GetTempate is a function to parse template with functions
 func GetTempate(templateBody string) (*template.Template, error) {
 	return template.New("message").
-		Funcs(template.FuncMap{
-			"normalizePrice":    NormalizePrice,
-			"getIcon":           GetIconByStatementItem,
-			"getCurrencySymbol": GetCurrencySymbol,
-			"unescapeString":    html.UnescapeString,
-		}).
+		Funcs(templateFuncs(fallbackLang, nil)).
 		Parse(templateBody)
 }
 
+// templateFuncs returns the functions of the templates in the language and the location, the default timezone is used without it
+func templateFuncs(lang Lang, loc *time.Location) template.FuncMap {
+	return template.FuncMap{
+		"normalizePrice":    func(price int) string { return FormatPrice(lang, price) },
+		"getIcon":           GetIconByStatementItem,
+		"add":               func(a, b int) int { return a + b },
+		"tags":              formatTags,
+		"getCurrencySymbol": GetCurrencySymbol,
+		"unescapeString":    html.UnescapeString,
+		"t":                 func(key string, args ...interface{}) string { return T(lang, key, args...) },
+		"period":            func(period string) string { return periodLabel(lang, period) },
+		"category":          func(mcc int) string { return T(lang, "category."+GetCategory(mcc)) },
+		"itemCategory":      func(item StatementItem) string { return CategoryLabel(lang, ItemCategory(item)) },
+		"date":              func(unix int, layout string) string { return FormatDate(loc, unix, layout) },
+		"time":              func(unix int) string { return FormatDate(loc, unix, "15:04") },
+		"day":               func(unix int) string { return FormatDay(lang, loc, unix) },
+		"relative":          func(unix int) string { return FormatRelative(lang, loc, unix, time.Now()) },
+		"percent":           func(part, total int) string { return FormatPercent(lang, part, total) },
+		"maskPan":           MaskPan,
+		"iban":              FormatIban,
+	}
+}
+
+// executeTemplate executes the copy of the template with the functions of the language and the location,
+// the parsed template is not executed to keep it clonable
+func executeTemplate(tmpl *template.Template, lang Lang, loc *time.Location, data interface{}) (string, error) {
+	t, err := tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+
+	var tpl bytes.Buffer
+	if err := t.Funcs(templateFuncs(lang, loc)).Execute(&tpl, data); err != nil {
+		return "", err
+	}
+
+	return tpl.String(), nil
+}
+
 // GetIconByStatementItem is a function get emoji/icons by MCC code
 func GetIconByStatementItem(statementItem StatementItem) string {
+	// the category of the user or the rules takes precedence over MCC
+	if statementItem.Category != "" {
+		if icon, ok := categoryIconMap[statementItem.Category]; ok {
+			return icon
+		}
+		return "🏷"
+	}
+
 	// defoult emoji
 	icon := "🛒"
 
@@ -93,6 +195,68 @@ func GetIconByStatementItem(statementItem StatementItem) string {
 	return icon
 }
 
+// GetCategory is a function get the category of the catalog by MCC code
+func GetCategory(mcc int) string {
+	if category, ok := mccCategoryMap[mcc]; ok {
+		return category
+	}
+
+	return "other"
+}
+
+// FormatPercent formats the part of the total in percents with a decimal, example: 12,5%
+func FormatPercent(lang Lang, part, total int) string {
+	if total == 0 {
+		return "0%"
+	}
+
+	// the tenths of the percent are rounded half away from zero
+	tenths := part * 1000 / total
+	if rest := part * 1000 % total; 2*abs(rest) >= abs(total) {
+		if (part < 0) != (total < 0) {
+			tenths--
+		} else {
+			tenths++
+		}
+	}
+
+	sign := ""
+	if tenths < 0 {
+		sign = "-"
+		tenths = -tenths
+	}
+
+	if tenths%10 == 0 {
+		return fmt.Sprintf("%s%d%%", sign, tenths/10)
+	}
+
+	return fmt.Sprintf("%s%d%s%d%%", sign, tenths/10, T(lang, "number.decimal"), tenths%10)
+}
+
+// MaskPan returns the last digits of the card numbers, example: *1234
+func MaskPan(pans []string) string {
+	masked := make([]string, 0, len(pans))
+	for _, pan := range pans {
+		if len(pan) > 4 {
+			pan = pan[len(pan)-4:]
+		}
+		masked = append(masked, "*"+pan)
+	}
+
+	return strings.Join(masked, ", ")
+}
+
+// FormatIban splits the IBAN into the groups of 4 characters, example: UA21 3223 1300 ...
+func FormatIban(iban string) string {
+	groups := []string{}
+	for len(iban) > 4 {
+		groups = append(groups, iban[:4])
+		iban = iban[4:]
+	}
+
+	return strings.Join(append(groups, iban), " ")
+}
+
 // GetCurrencySymbol is a function get currency symbol by code
 func GetCurrencySymbol(currencyCode int) string {
 	symbol := ""
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// names of the templates, the files of the overrides are <name>.tmpl
+const (
+	statementTemplateName = "statement"
+	balanceTemplateName   = "balance"
+	reportTemplateName    = "report"
+	webhookTemplateName   = "webhook"
+	detailTemplateName    = "detail"
+	searchTemplateName    = "search"
+
+	templateExt = ".tmpl"
+)
+
+// builtinTemplates are the templates compiled into the binary
+var builtinTemplates = map[string]string{
+	statementTemplateName: statementTemplate,
+	balanceTemplateName:   balanceTemplate,
+	reportTemplateName:    reportPageTemplate,
+	webhookTemplateName:   webhookTemplate,
+	detailTemplateName:    detailTemplate,
+	searchTemplateName:    searchTemplate,
+}
+
+// StatementMessage is a structure to render the statement item received by the webhook
+type StatementMessage struct {
+	Name          string
+	StatementItem StatementItem
+	Account       Account
+}
+
+// sampleAccount is an account to validate the templates
+var sampleAccount = Account{
+	ID:           "sample",
+	Type:         "black",
+	CurrencyCode: 980,
+	CashbackType: "UAH",
+	Balance:      1234567,
+	CreditLimit:  0,
+	Iban:         "UA213223130000026007233566001",
+	MaskedPan:    []string{"537541******1234"},
+}
+
+// sampleStatementItem is a statement item to validate the templates
+var sampleStatementItem = StatementItem{
+	ID:              "sample",
+	Time:            1700000000,
+	Description:     "Сільпо",
+	Mcc:             5411,
+	OriginalMcc:     5499,
+	Hold:            true,
+	Amount:          -12550,
+	OperationAmount: -12550,
+	CurrencyCode:    980,
+	CommissionRate:  0,
+	CashbackAmount:  125,
+	Balance:         1234567,
+	Comment:         "comment",
+	Note:            "note",
+	Tags:            []string{"vacation"},
+	Receipts:        1,
+	Category:        "groceries",
+}
+
+// templateSamples are the data of the templates by the name, every template is executed with it on loading
+var templateSamples = map[string]interface{}{
+	statementTemplateName: StatementMessage{Name: "Name", StatementItem: sampleStatementItem, Account: sampleAccount},
+	balanceTemplateName:   ClientInfo{Name: "Name", WebHookURL: "https://example.com", Accounts: []Account{sampleAccount}},
+	reportTemplateName: ReportPage{
+		StatementItems:      []StatementItem{sampleStatementItem},
+		SpentTotal:          12550,
+		AmountTotal:         -12550,
+		CurrencyCode:        980,
+		CashbackAmountTotal: 125,
+		Period:              "This month",
+		Tag:                 "vacation",
+	},
+	webhookTemplateName: ClientInfo{Name: "Name", WebHookURL: "https://example.com", Accounts: []Account{sampleAccount}},
+	detailTemplateName:  StatementMessage{Name: "Name", StatementItem: sampleStatementItem, Account: sampleAccount},
+	searchTemplateName: SearchPage{
+		Query:   "silpo amount>100",
+		Total:   1,
+		Totals:  []SearchTotal{{CurrencyCode: 980, Spent: 12550}},
+		Results: []SearchResult{{Name: "Name", CurrencyCode: 980, StatementItem: sampleStatementItem}},
+	},
+}
+
+// Templates is a set of the templates with the overrides of the clients and the chats
+type Templates struct {
+	defaults map[string]*template.Template
+	clients  map[string]map[string]*template.Template // by the alias or the id of the client
+	chats    map[int64]map[string]*template.Template
+}
+
+// LoadTemplates returns the built-in templates with the overrides from the directory:
+// <dir>/<name>.tmpl, <dir>/clients/<alias or id>/<name>.tmpl and <dir>/chats/<chat id>/<name>.tmpl,
+// every template is validated with the sample data.
+func LoadTemplates(dir string) (*Templates, error) {
+	t := &Templates{
+		defaults: map[string]*template.Template{},
+		clients:  map[string]map[string]*template.Template{},
+		chats:    map[int64]map[string]*template.Template{},
+	}
+
+	for name, body := range builtinTemplates {
+		tmpl, err := parseTemplate(name, body)
+		if err != nil {
+			return nil, err
+		}
+		t.defaults[name] = tmpl
+	}
+
+	if dir == "" {
+		return t, nil
+	}
+
+	overrides, err := loadTemplateFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	for name, tmpl := range overrides {
+		t.defaults[name] = tmpl
+	}
+
+	clients, err := loadTemplateDirs(filepath.Join(dir, "clients"), func(name string) (string, error) {
+		return name, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.clients = clients
+
+	chats, err := loadTemplateDirs(filepath.Join(dir, "chats"), func(name string) (int64, error) {
+		return strconv.ParseInt(name, 10, 64)
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.chats = chats
+
+	return t, nil
+}
+
+// loadTemplateDirs loads the overrides from the subdirectories, the key is parsed from the name of the subdirectory
+func loadTemplateDirs[K comparable](dir string, key func(name string) (K, error)) (map[K]map[string]*template.Template, error) {
+	result := map[K]map[string]*template.Template{}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		k, err := key(entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("templates %s: incorrect name %s", dir, entry.Name())
+		}
+
+		templates, err := loadTemplateFiles(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		result[k] = templates
+	}
+
+	return result, nil
+}
+
+// templateNames returns the sorted names of the builtin templates
+func templateNames() []string {
+	names := make([]string, 0, len(builtinTemplates))
+	for name := range builtinTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// loadTemplateFiles parses and validates the <name>.tmpl files of the directory, unknown names are an error
+func loadTemplateFiles(dir string) (map[string]*template.Template, error) {
+	result := map[string]*template.Template{}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != templateExt {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		name := strings.TrimSuffix(entry.Name(), templateExt)
+		if _, ok := builtinTemplates[name]; !ok {
+			return nil, fmt.Errorf("template %s: unknown name, available: %s", path, strings.Join(templateNames(), ", "))
+		}
+
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		tmpl, err := parseTemplate(name, string(body))
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", path, err)
+		}
+		result[name] = tmpl
+	}
+
+	return result, nil
+}
+
+// parseTemplate parses the template and executes it with the sample data in every language
+func parseTemplate(name, body string) (*template.Template, error) {
+	tmpl, err := GetTempate(body)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, lang := range languages() {
+		if _, err := executeTemplate(tmpl, Lang(lang), nil, templateSamples[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	return tmpl, nil
+}
+
+// get returns the template of the chat, the client by the alias or the id, the configured one of the client
+// or the default one
+func (t *Templates) get(name string, client Client, chatID int64, configured *template.Template) *template.Template {
+	if tmpl, ok := t.chats[chatID][name]; ok {
+		return tmpl
+	}
+
+	if client != nil {
+		for _, key := range []string{client.GetAlias(), fmt.Sprintf("%d", client.GetID())} {
+			if tmpl, ok := t.clients[key][name]; ok && key != "" {
+				return tmpl
+			}
+		}
+	}
+
+	if configured != nil {
+		return configured
+	}
+
+	return t.defaults[name]
+}
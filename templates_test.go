@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestTemplate(t *testing.T, path, body string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadTemplates(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTemplate(t, filepath.Join(dir, "balance.tmpl"), `default {{ .Name }}`)
+	writeTestTemplate(t, filepath.Join(dir, "clients", "family", "balance.tmpl"), `family {{ .Name }}`)
+	writeTestTemplate(t, filepath.Join(dir, "chats", "-100", "balance.tmpl"), `chat {{ .Name }}`)
+
+	templates, err := LoadTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configured, err := parseTemplate(balanceTemplateName, `configured {{ .Name }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	family := NewClient(ClientConfig{Alias: "family"})
+	personal := NewClient(ClientConfig{Alias: "personal"})
+
+	var tests = []struct {
+		client     Client
+		chatID     int64
+		configured bool
+		expected   string
+	}{
+		{family, -100, true, "chat Name"},
+		{family, 1, true, "family Name"},
+		{personal, 1, true, "configured Name"},
+		{personal, 1, false, "default Name"},
+		{nil, 1, false, "default Name"},
+	}
+
+	for _, test := range tests {
+		var tmpl = configured
+		if !test.configured {
+			tmpl = nil
+		}
+
+		message, err := executeTemplate(templates.get(balanceTemplateName, test.client, test.chatID, tmpl), LangEN, nil, ClientInfo{Name: "Name"})
+		if err != nil || message != test.expected {
+			t.Error("Expected", test.expected, "got", message, err)
+		}
+	}
+
+	// the built-in templates are used without the overrides
+	message, err := executeTemplate(templates.get(webhookTemplateName, family, -100, nil), LangEN, nil, ClientInfo{})
+	if err != nil || message != "Webhook:  Not set " {
+		t.Errorf("Expected the built-in webhook template, got %q %v", message, err)
+	}
+}
+
+func TestLoadTemplatesErrors(t *testing.T) {
+	var tests = []struct {
+		path  string
+		body  string
+		error string
+	}{
+		{"unknown.tmpl", `{{ .Name }}`, "unknown name, available: balance, detail, report, search, statement, webhook"},
+		{"statement.tmpl", `{{ .Name `, "unclosed action"},
+		{"statement.tmpl", `{{ .Missing }}`, "can't evaluate field Missing"},
+		{filepath.Join("clients", "family", "report.tmpl"), `{{ normalizePrice .Period }}`, "wrong type"},
+		{filepath.Join("chats", "family", "report.tmpl"), `{{ .Period }}`, "incorrect name family"},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		writeTestTemplate(t, filepath.Join(dir, test.path), test.body)
+
+		if _, err := LoadTemplates(dir); err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Error("For", test.path, "expected", test.error, "got", err)
+		}
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	var tests = []struct {
+		body     string
+		lang     Lang
+		expected string
+	}{
+		{`{{ category 5411 }}`, LangEN, "Groceries"},
+		{`{{ category 1 }}`, LangUK, "Інше"},
+		{`{{ date 1700000000 "02.01.2006 15:04" }}`, LangEN, "15.11.2023 00:13"},
+		{`{{ percent 125 12550 }}`, LangUK, "1%"},
+		{`{{ percent 1 8 }}`, LangUK, "12,5%"},
+		{`{{ percent -1 3 }}`, LangEN, "-33.3%"},
+		{`{{ percent 1 0 }}`, LangEN, "0%"},
+		{`{{ maskPan .MaskedPan }}`, LangEN, "*1234"},
+		{`{{ iban .Iban }}`, LangEN, "UA21 3223 1300 0002 6007 2335 6600 1"},
+	}
+
+	for _, test := range tests {
+		tmpl, err := GetTempate(test.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		message, err := executeTemplate(tmpl, test.lang, nil, sampleAccount)
+		if err != nil || message != test.expected {
+			t.Error("For", test.body, "expected", test.expected, "got", message, err)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	userClientsBucket = "user_clients"
+
+	// the time to send the token after /connect
+	connectTimeout = 10 * time.Minute
+)
+
+var errUserClientNotFound = errors.New("monobank token is not connected")
+
+// UserClient is a monobank client connected by the user, the token is encrypted
+type UserClient struct {
+	UserID    int64     `json:"userId"`
+	Token     string    `json:"token"`
+	Shared    []int64   `json:"shared"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// loadUserClients initializes the clients connected by the users, the clients with errors are skipped
+func (b *bot) loadUserClients() error {
+	userClients := []UserClient{}
+	err := b.storage.ForEach(userClientsBucket, func(key string, value []byte) error {
+		var userClient UserClient
+		if err := json.Unmarshal(value, &userClient); err != nil {
+			return err
+		}
+
+		userClients = append(userClients, userClient)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, userClient := range userClients {
+		token, err := DecryptSecrets([]byte(userClient.Token), b.userTokensKey)
+		if err != nil {
+			return fmt.Errorf("user %d token: %w", userClient.UserID, err)
+		}
+
+		logRedactor.Add(string(token))
+
+		client := NewClient(ClientConfig{Token: string(token)})
+		if err := client.Init(); err != nil {
+			log.Error().Err(err).Msgf("[tenant] init client of %d", userClient.UserID)
+			continue
+		}
+
+		b.addUserClient(client, userClient)
+	}
+
+	log.Info().Msgf("[tenant] %d user clients", len(userClients))
+	return nil
+}
+
+// addUserClient adds the client visible only to the user and the shared chats
+func (b *bot) addUserClient(client Client, userClient UserClient) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.userClients = append(b.userClients, client)
+	b.settings[client.GetID()] = &clientSettings{
+		config: ClientConfig{Token: "***"},
+		index:  -1,
+		owner:  userClient.UserID,
+		shared: userClient.Shared,
+	}
+}
+
+// getUserClient returns the client connected by the user
+func (b *bot) getUserClient(userID int64) (Client, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, client := range b.userClients {
+		if settings, ok := b.settings[client.GetID()]; ok && settings.owner == userID {
+			return client, nil
+		}
+	}
+
+	return nil, errUserClientNotFound
+}
+
+// connectUserClient checks the token, saves it encrypted and adds the client of the user
+func (b *bot) connectUserClient(userID int64, token string) (Client, error) {
+	logRedactor.Add(token)
+
+	if _, err := b.getUserClient(userID); err == nil {
+		return nil, errors.New("monobank token is already connected, /disconnect it first")
+	}
+
+	client := NewClient(ClientConfig{Token: token})
+	if err := client.Init(); err != nil {
+		return nil, err
+	}
+
+	if b.isClient(client.GetID()) {
+		return nil, errors.New("the monobank client is already connected")
+	}
+
+	encrypted, err := EncryptSecrets([]byte(token), b.userTokensKey)
+	if err != nil {
+		return nil, err
+	}
+
+	userClient := UserClient{
+		UserID:    userID,
+		Token:     string(encrypted),
+		CreatedAt: time.Now(),
+	}
+
+	if err := b.storage.Put(userClientsBucket, strconv.FormatInt(userID, 10), userClient); err != nil {
+		return nil, err
+	}
+
+	b.addUserClient(client, userClient)
+	return client, nil
+}
+
+// isClient checks the client with the id exists
+func (b *bot) isClient(id uint32) bool {
+	for _, client := range b.getClients() {
+		if client.GetID() == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// disconnectUserClient deletes the token and the client of the user
+func (b *bot) disconnectUserClient(userID int64) error {
+	client, err := b.getUserClient(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := b.storage.Delete(userClientsBucket, strconv.FormatInt(userID, 10)); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	userClients := []Client{}
+	for _, c := range b.userClients {
+		if c != client {
+			userClients = append(userClients, c)
+		}
+	}
+
+	b.userClients = userClients
+	delete(b.settings, client.GetID())
+
+	return nil
+}
+
+// shareUserClient shares the client of the user with the chat or stops sharing
+func (b *bot) shareUserClient(userID, chatID int64, share bool) error {
+	client, err := b.getUserClient(userID)
+	if err != nil {
+		return err
+	}
+
+	key := strconv.FormatInt(userID, 10)
+	return b.storage.Update(func(tx StorageTx) error {
+		var userClient UserClient
+		if ok, err := tx.Get(userClientsBucket, key, &userClient); err != nil {
+			return err
+		} else if !ok {
+			return errUserClientNotFound
+		}
+
+		shared := []int64{}
+		for _, id := range userClient.Shared {
+			if id != chatID {
+				shared = append(shared, id)
+			}
+		}
+
+		if share {
+			shared = append(shared, chatID)
+		}
+		userClient.Shared = shared
+
+		if err := tx.Put(userClientsBucket, key, userClient); err != nil {
+			return err
+		}
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if settings, ok := b.settings[client.GetID()]; ok {
+			updated := *settings
+			updated.shared = shared
+			b.settings[client.GetID()] = &updated
+		}
+
+		return nil
+	})
+}
+
+// isConnecting checks the user sends the token after /connect
+func (b *bot) isConnecting(userID int64) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	startedAt, ok := b.connecting[userID]
+	return ok && time.Since(startedAt) < connectTimeout
+}
+
+// setConnecting starts or stops waiting for the token of the user
+func (b *bot) setConnecting(userID int64, connecting bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if connecting {
+		b.connecting[userID] = time.Now()
+	} else {
+		delete(b.connecting, userID)
+	}
+}
+
+// handleConnect handles /connect [token] in the private chat, the message with the token is deleted
+func (b *bot) handleConnect(c commandContext) {
+	message := c.Message
+	userID := int64(message.From.ID)
+
+	if !b.multiTenant || message.Chat.ID != userID {
+		// the token should not stay in the history of the group, the answer is not a reply to the deleted message
+		if c.Arg(0) != "" {
+			b.deleteTokenMessage(message)
+			b.send(tgbotapi.NewMessage(message.Chat.ID, T(c.Lang, "connect_private")))
+			return
+		}
+
+		b.reply(message, T(c.Lang, "connect_private"))
+		return
+	}
+
+	token := c.Arg(0)
+	if token == "" {
+		b.setConnecting(userID, true)
+		b.reply(message, T(c.Lang, "connect_token"))
+		return
+	}
+
+	b.connectToken(message, token)
+}
+
+// connectToken connects the token sent by the user
+func (b *bot) connectToken(message *tgbotapi.Message, token string) {
+	userID := int64(message.From.ID)
+	lang := b.messageLanguage(message)
+	b.setConnecting(userID, false)
+
+	b.deleteTokenMessage(message)
+
+	client, err := b.connectUserClient(userID, token)
+	if err != nil {
+		log.Error().Err(err).Msgf("[tenant] connect by %d", userID)
+		b.send(tgbotapi.NewMessage(message.Chat.ID, T(lang, "connect_error", err)))
+		return
+	}
+
+	log.Info().Msgf("[tenant] connected by %d", userID)
+	b.send(tgbotapi.NewMessage(message.Chat.ID, T(lang, "connected", client.GetName())))
+}
+
+// deleteTokenMessage deletes the message with the token, the token should not stay in the chat history
+func (b *bot) deleteTokenMessage(message *tgbotapi.Message) {
+	botAPI := b.getBotAPI()
+	if botAPI == nil {
+		return
+	}
+
+	if _, err := botAPI.DeleteMessage(tgbotapi.DeleteMessageConfig{ChatID: message.Chat.ID, MessageID: message.MessageID}); err != nil {
+		log.Error().Err(err).Msg("[tenant] delete token message")
+	}
+}
+
+// handleDisconnect handles /disconnect, the token of the user is deleted
+func (b *bot) handleDisconnect(c commandContext) {
+	message := c.Message
+	if err := b.disconnectUserClient(int64(message.From.ID)); err != nil {
+		b.reply(message, err.Error())
+		return
+	}
+
+	log.Info().Msgf("[tenant] disconnected by %d", message.From.ID)
+	b.reply(message, T(c.Lang, "disconnected"))
+}
+
+// handleShare handles /share [chat id] and /unshare [chat id], the current chat is used without the id
+func (b *bot) handleShare(c commandContext, share bool) {
+	message := c.Message
+	chatID := message.Chat.ID
+	if ref := c.Arg(0); ref != "" {
+		id, err := strconv.ParseInt(ref, 10, 64)
+		if err != nil {
+			b.reply(message, T(c.Lang, "incorrect_chat_id"))
+			return
+		}
+		chatID = id
+	}
+
+	if chatID == int64(message.From.ID) {
+		b.reply(message, T(c.Lang, "share_chat"))
+		return
+	}
+
+	// the data is shared only with the existing chats of the user, the chat is left to unshare it anyway
+	if share {
+		member, err := b.isChatMember(chatID, int64(message.From.ID))
+		if err != nil {
+			log.Warn().Err(err).Msgf("[tenant] share, chat %d", chatID)
+		}
+
+		if !member {
+			b.reply(message, T(c.Lang, "share_not_member", chatID))
+			return
+		}
+	}
+
+	if err := b.shareUserClient(int64(message.From.ID), chatID, share); err != nil {
+		b.reply(message, err.Error())
+		return
+	}
+
+	if share {
+		b.reply(message, T(c.Lang, "shared", chatID))
+	} else {
+		b.reply(message, T(c.Lang, "unshared", chatID))
+	}
+}
+
+// isChatMember checks the chat exists and the user is its member, the bot has to be in the chat to check it
+func (b *bot) isChatMember(chatID, userID int64) (bool, error) {
+	botAPI := b.getBotAPI()
+	if botAPI == nil {
+		return false, errors.New("telegram is not started")
+	}
+
+	member, err := botAPI.GetChatMember(tgbotapi.ChatConfigWithUser{ChatID: chatID, UserID: int(userID)})
+	if err != nil {
+		return false, err
+	}
+
+	return member.IsCreator() || member.IsAdministrator() || member.IsMember(), nil
+}
+
+// reply sends the text as a reply to the message
+func (b *bot) reply(message *tgbotapi.Message, text string) {
+	b.replyMessage(message, tgbotapi.NewMessage(message.Chat.ID, text))
+}
+
+// replyHTML replies to the message with the HTML markup rendered by the templates
+func (b *bot) replyHTML(message *tgbotapi.Message, text string) {
+	b.replyMessage(message, htmlMessage(message.Chat.ID, text))
+}
+
+// replyMessage sends the message as a reply to the message
+func (b *bot) replyMessage(message *tgbotapi.Message, msg tgbotapi.MessageConfig) {
+	msg.ReplyToMessageID = message.MessageID
+
+	if _, err := b.send(msg); err != nil {
+		log.Error().Err(err).Msg("[telegram] reply, send msg error")
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"golang.org/x/time/rate"
+)
+
+func TestUserClientVisibility(t *testing.T) {
+	b := newTestInviteBot(t)
+	b.settings = map[uint32]*clientSettings{}
+
+	userClient := &client{id: 5, limiter: rate.NewLimiter(0, 0), reports: map[string]Report{}}
+	if err := b.storage.Put(userClientsBucket, "2", UserClient{UserID: 2}); err != nil {
+		t.Fatal(err)
+	}
+	b.addUserClient(userClient, UserClient{UserID: 2})
+
+	var tests = []struct {
+		userID   int64
+		chatID   int64
+		expected bool
+	}{
+		{2, 2, true},
+		{1, 1, false},
+		{2, -10, false},
+	}
+
+	for _, test := range tests {
+		grant, _ := b.getAccess().resolve(test.chatID)
+		if b.canSeeClient(grant, userClient) != test.expected {
+			t.Error("user", test.userID, "chat", test.chatID, "expected", test.expected)
+		}
+	}
+
+	if err := b.shareUserClient(2, -10, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if grant, _ := b.getAccess().resolve(-10); !b.canSeeClient(grant, userClient) {
+		t.Error("Expected visible in the shared chat")
+	}
+
+	if ids := b.recipients(userClient, "acc"); len(ids) != 2 || ids[0] != 2 || ids[1] != -10 {
+		t.Error("Expected [2 -10], got ", ids)
+	}
+
+	var stored UserClient
+	if _, err := b.storage.Get(userClientsBucket, "2", &stored); err != nil || len(stored.Shared) != 1 {
+		t.Error("Expected stored shared chat, got ", stored.Shared, err)
+	}
+
+	if err := b.disconnectUserClient(2); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b.getClients()) != 0 {
+		t.Error("Expected 0, got ", len(b.getClients()))
+	}
+
+	if err := b.disconnectUserClient(2); err != errUserClientNotFound {
+		t.Error("Expected errUserClientNotFound, got ", err)
+	}
+}
+
+func TestConnectInGroup(t *testing.T) {
+	b := newTestInviteBot(t)
+	b.multiTenant = true
+	telegram := newTestTelegram(b)
+
+	// the token sent to the group is deleted before the answer
+	message := &tgbotapi.Message{MessageID: 7, Chat: &tgbotapi.Chat{ID: -5}, From: &tgbotapi.User{ID: 2}}
+	b.handleConnect(commandContext{Message: message, Args: []string{"token"}, Lang: LangEN})
+
+	if len(telegram.methods) != 2 || telegram.methods[0] != "deleteMessage" || telegram.params[0].Get("message_id") != "7" {
+		t.Fatal("Expected the deleted message and the answer, got ", telegram.methods)
+	}
+
+	if reply := telegram.params[1].Get("reply_to_message_id"); reply != "" && reply != "0" {
+		t.Error("Expected no reply to the deleted message, got ", reply)
+	}
+
+	// the command without the token is answered
+	telegram.methods = nil
+	b.handleConnect(commandContext{Message: message, Lang: LangEN})
+	if len(telegram.methods) != 1 || telegram.methods[0] != "sendMessage" {
+		t.Error("Expected the answer only, got ", telegram.methods)
+	}
+}
+
+func TestOwnCommandInGroup(t *testing.T) {
+	b := newTestInviteBot(t)
+	b.multiTenant = true
+	telegram := newTestTelegram(b)
+
+	// the group -5 has no role, only the commands of the own data of the owner are handled
+	message := &tgbotapi.Message{Text: "/balance", Chat: &tgbotapi.Chat{ID: -5}, From: &tgbotapi.User{ID: 1}}
+	b.handleMessage(message)
+	if len(telegram.methods) != 0 {
+		t.Error("Expected no answer, got ", telegram.methods)
+	}
+
+	telegram.responses["getChatMember"] = `{"ok":true,"result":{"status":"creator"}}`
+	message.Text = "/share"
+	b.handleMessage(message)
+	if len(telegram.methods) != 2 || telegram.params[1].Get("text") != errUserClientNotFound.Error() {
+		t.Error("Expected the answer of /share, got ", telegram.methods, telegram.params)
+	}
+}
+
+func TestShareChatMember(t *testing.T) {
+	b := newTestInviteBot(t)
+	b.multiTenant = true
+	b.settings = map[uint32]*clientSettings{}
+	telegram := newTestTelegram(b)
+
+	userClient := &client{id: 5, limiter: rate.NewLimiter(0, 0), reports: map[string]Report{}}
+	if err := b.storage.Put(userClientsBucket, "2", UserClient{UserID: 2}); err != nil {
+		t.Fatal(err)
+	}
+	b.addUserClient(userClient, UserClient{UserID: 2})
+
+	var tests = []struct {
+		response string
+		expected bool
+	}{
+		{`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`, false},
+		{`{"ok":true,"result":{"status":"left"}}`, false},
+		{`{"ok":true,"result":{"status":"kicked"}}`, false},
+		{`{"ok":true,"result":{"status":"member"}}`, true},
+	}
+
+	message := &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 2}, From: &tgbotapi.User{ID: 2}}
+	for _, test := range tests {
+		telegram.responses["getChatMember"] = test.response
+		b.handleShare(commandContext{Message: message, Args: []string{"-10"}, Lang: LangEN}, true)
+
+		if shared := len(b.getClientSettings(userClient).shared) == 1; shared != test.expected {
+			t.Error(test.response, "expected", test.expected, "got", shared)
+		}
+	}
+
+	if params := telegram.params[0]; params.Get("chat_id") != "-10" || params.Get("user_id") != "2" {
+		t.Error("Expected the member 2 of the chat -10, got ", params)
+	}
+}
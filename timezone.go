@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	timezonesBucket = "timezones"
+	defaultTimezone = "Europe/Kiev"
+)
+
+// loadLocation returns the location by the IANA name, the default timezone is used for the empty name
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		name = defaultTimezone
+	}
+
+	return time.LoadLocation(name)
+}
+
+// orDefaultLocation returns the location or the default timezone, UTC if the timezone database is missing
+func orDefaultLocation(loc *time.Location) *time.Location {
+	if loc != nil {
+		return loc
+	}
+
+	loc, err := loadLocation("")
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
+
+// FormatDate formats the unix time in the location, the layout is of the time package, example: 02.01.2006 15:04
+func FormatDate(loc *time.Location, unix int, layout string) string {
+	return time.Unix(int64(unix), 0).In(orDefaultLocation(loc)).Format(layout)
+}
+
+// FormatDay formats the day of the unix time in the language, example: 14 жовтня
+func FormatDay(lang Lang, loc *time.Location, unix int) string {
+	t := time.Unix(int64(unix), 0).In(orDefaultLocation(loc))
+
+	return fmt.Sprintf("%d %s", t.Day(), T(lang, fmt.Sprintf("month_of.%d", t.Month())))
+}
+
+// FormatRelative formats the recent unix time relatively to now, example: 5 хв тому,
+// the older times are formatted as 15:04
+func FormatRelative(lang Lang, loc *time.Location, unix int, now time.Time) string {
+	ago := now.Sub(time.Unix(int64(unix), 0))
+
+	switch {
+	case ago < 0:
+		break
+	case ago < time.Minute:
+		return T(lang, "relative.now")
+	case ago < time.Hour:
+		return T(lang, "relative.minutes", int(ago/time.Minute))
+	case ago < 6*time.Hour:
+		return T(lang, "relative.hours", int(ago/time.Hour))
+	}
+
+	return FormatDate(loc, unix, "15:04")
+}
+
+// timezone returns the location of the chat, the default one if it is not set
+func (b *bot) timezone(chatID int64) *time.Location {
+	var name string
+	if ok, err := b.storage.Get(timezonesBucket, strconv.FormatInt(chatID, 10), &name); err != nil {
+		log.Error().Err(err).Msg("[timezone] get timezone")
+	} else if ok {
+		if loc, err := loadLocation(name); err == nil {
+			return loc
+		}
+	}
+
+	return b.defaultLocation()
+}
+
+// setTimezone saves the timezone of the chat
+func (b *bot) setTimezone(chatID int64, name string) error {
+	return b.storage.Put(timezonesBucket, strconv.FormatInt(chatID, 10), name)
+}
+
+func (b *bot) defaultLocation() *time.Location {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return orDefaultLocation(b.location)
+}
+
+// cmdTimezone handles /timezone [name], the current timezone is sent without the name, example: /timezone Europe/Warsaw
+func (b *bot) cmdTimezone(c commandContext) {
+	name := c.Arg(0)
+	if name == "" {
+		b.reply(c.Message, T(c.Lang, "timezone_current", b.timezone(c.Message.Chat.ID)))
+		return
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		b.reply(c.Message, T(c.Lang, "timezone_unknown", name))
+		return
+	}
+
+	if err := b.setTimezone(c.Message.Chat.ID, loc.String()); err != nil {
+		log.Error().Err(err).Msg("[timezone] set timezone")
+		b.reply(c.Message, err.Error())
+		return
+	}
+
+	b.reply(c.Message, T(c.Lang, "timezone_set", loc, FormatDate(loc, int(time.Now().Unix()), "15:04")))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatDay(t *testing.T) {
+	warsaw, err := time.LoadLocation("Europe/Warsaw")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2023-11-14 23:13 UTC
+	var tests = []struct {
+		lang     Lang
+		loc      *time.Location
+		expected string
+	}{
+		{LangUK, nil, "15 листопада"},
+		{LangEN, warsaw, "15 November"},
+		{LangEN, time.UTC, "14 November"},
+	}
+
+	for _, test := range tests {
+		if day := FormatDay(test.lang, test.loc, 1700003580); day != test.expected {
+			t.Error("Expected", test.expected, "got", day)
+		}
+	}
+}
+
+func TestFormatRelative(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	var tests = []struct {
+		ago      time.Duration
+		lang     Lang
+		expected string
+	}{
+		{10 * time.Second, LangEN, "just now"},
+		{5 * time.Minute, LangUK, "5 хв тому"},
+		{2*time.Hour + time.Minute, LangEN, "2 h ago"},
+		{7 * time.Hour, LangEN, "17:13"},
+		{-time.Hour, LangEN, "01:13"},
+	}
+
+	for _, test := range tests {
+		if relative := FormatRelative(test.lang, nil, int(now.Add(-test.ago).Unix()), now); relative != test.expected {
+			t.Error("Expected", test.expected, "got", relative)
+		}
+	}
+}
+
+func TestReportDaySeparators(t *testing.T) {
+	tmpl, err := GetTempate(reportPageTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page := ReportPage{StatementItems: []StatementItem{
+		{Time: 1700000000, Description: "first"},
+		{Time: 1699990000, Description: "second"},
+		{Time: 1699900000, Description: "third"},
+	}}
+
+	message, err := executeTemplate(tmpl, LangEN, time.UTC, page)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Count(message, "— 14 November —") != 1 || strings.Count(message, "— 13 November —") != 1 {
+		t.Errorf("Expected a separator for every day, got %q", message)
+	}
+
+	if strings.Index(message, "— 13 November —") > strings.Index(message, "third") ||
+		strings.Index(message, "— 13 November —") < strings.Index(message, "second") {
+		t.Errorf("Expected the separator before the items of the day, got %q", message)
+	}
+}
+
+func TestTimezone(t *testing.T) {
+	b := newTestInviteBot(t)
+
+	if loc := b.timezone(2); loc.String() != defaultTimezone {
+		t.Error("Expected", defaultTimezone, "got", loc)
+	}
+
+	if err := b.setTimezone(2, "Europe/Warsaw"); err != nil {
+		t.Fatal(err)
+	}
+
+	if loc := b.timezone(2); loc.String() != "Europe/Warsaw" {
+		t.Error("Expected Europe/Warsaw, got ", loc)
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
-	"strings"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
@@ -119,6 +118,17 @@ func abs[T constraints.Integer | constraints.Float](n T) T {
 	return n
 }
 
+// contains checks the value is in the slice
+func contains[T comparable](values []T, value T) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
 func getTimeRangeByPeriod(period string) (int64, int64, error) {
 	var from, to int64
 
@@ -175,49 +185,6 @@ func getTimeRangeByPeriod(period string) (int64, int64, error) {
 	return from, to, nil
 }
 
-type pageData struct {
-	Page     int
-	Account  string
-	FromID   int
-	ChatID   int64
-	Period   string
-	ClientID uint32
-}
-
-func callbackQueryDataParser(data string) pageData {
-	// prefix + Period + FromID + ChatID + clientID + page
-	// example: r:1:12321324:312234234:23423432:1
-	arr := strings.Split(data, ":")
-
-	// not checking errors because it always will be correct numbers
-	period := arr[1]
-	clientID, _ := strconv.ParseUint(arr[4], 10, 32)
-	account := arr[5]
-	page, _ := strconv.Atoi(arr[6])
-
-	return pageData{
-		Page:     page,
-		Period:   period,
-		ClientID: uint32(clientID),
-		Account:  account,
-	}
-}
-
-func callbackQueryDataBuilder(prefix string, data pageData) string {
-	// prefix + Period + FromID + ChatID + clientID + page
-	// example: r:1:12321324:312234234:23423432:1
-
-	return fmt.Sprintf("%s:%s:%d:%d:%d:%s:",
-		prefix,
-		data.Period,
-		0, // data.FromID,
-		0, // data.ChatID,
-		data.ClientID,
-		data.Account,
-		//data.Page,
-	)
-}
-
 // IsURL is a url validate function
 func IsURL(str string) bool {
 	u, err := url.Parse(str)
@@ -225,12 +192,18 @@ func IsURL(str string) bool {
 }
 
 func DoRequest[D any](data D, req *http.Request) (D, error) {
+	endpoint := monobankEndpoint(req.URL.Path)
+
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
+		monobankRequests.WithLabelValues(endpoint, "error").Inc()
+
 		log.Error().Err(err).Msg("[DoRequest] request")
 		return data, err
 	}
 
+	monobankRequests.WithLabelValues(endpoint, strconv.Itoa(res.StatusCode)).Inc()
+
 	defer res.Body.Close()
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
@@ -238,11 +211,27 @@ func DoRequest[D any](data D, req *http.Request) (D, error) {
 		return data, err
 	}
 
+	if res.StatusCode >= http.StatusBadRequest {
+		var apiError struct {
+			ErrorDescription string `json:"errorDescription"`
+		}
+		json.Unmarshal(body, &apiError)
+
+		err := fmt.Errorf("monobank api: %s", res.Status)
+		if apiError.ErrorDescription != "" {
+			err = fmt.Errorf("monobank api: %s", apiError.ErrorDescription)
+		}
+
+		log.Error().Err(err).Msg("[DoRequest] response status")
+		return data, err
+	}
+
 	if err := json.Unmarshal(body, &data); err != nil {
 		log.Error().Err(err).Msg("[DoRequest] unmarshal")
 		return data, err
 	}
 
-	log.Debug().Msgf("[DoRequest] responce %s", string(body))
+	// the body has personal data and the webhook url with the secret, so it is not logged
+	log.Debug().Msgf("[DoRequest] response %s %s, %d bytes", endpoint, res.Status, len(body))
 	return data, nil
 }
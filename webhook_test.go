@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func newTestWebhookBot(t *testing.T) *bot {
+	storage, _ := newTestStorage(t)
+	t.Cleanup(func() { storage.Close() })
+
+	return &bot{
+		webhookSecret: "s3cret",
+		storage:       storage,
+		queue:         NewQueue(storage),
+		notify:        make(chan struct{}, 1),
+		clients: []Client{
+			&client{
+				id:      1,
+				Info:    &ClientInfo{Accounts: []Account{{ID: "acc"}}},
+				limiter: rate.NewLimiter(0, 0),
+				reports: map[string]Report{},
+			},
+		},
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	b := newTestWebhookBot(t)
+
+	var tests = []struct {
+		method   string
+		body     string
+		expected int
+		queued   int
+	}{
+		{http.MethodGet, "", http.StatusOK, 0},
+		{http.MethodPut, "", http.StatusMethodNotAllowed, 0},
+		{http.MethodPost, "{", http.StatusBadRequest, 0},
+		{http.MethodPost, `{"type":"Other","data":{"account":"acc"}}`, http.StatusBadRequest, 0},
+		{http.MethodPost, `{"type":"StatementItem","data":{"account":"fake","statementItem":{"id":"st1"}}}`, http.StatusForbidden, 0},
+		{http.MethodPost, `{"type":"StatementItem","data":{"account":"acc","statementItem":{"id":"st1"}}}`, http.StatusOK, 1},
+		{http.MethodPost, `{"type":"StatementItem","data":{"account":"acc","statementItem":{"id":"st1"}}}`, http.StatusOK, 1},
+		{http.MethodPost, `{"type":"StatementItem","data":{"account":"acc","description":"` + strings.Repeat("a", webhookMaxBodySize) + `"}}`, http.StatusRequestEntityTooLarge, 1},
+	}
+
+	for i, test := range tests {
+		req := httptest.NewRequest(test.method, b.webhookPath(), strings.NewReader(test.body))
+		w := httptest.NewRecorder()
+
+		b.handleWebhook(w, req)
+
+		if w.Code != test.expected {
+			t.Error("request", i, "expected", test.expected, "got", w.Code)
+		}
+		if length := b.queue.Len(); length != test.queued {
+			t.Error("request", i, "expected queue length", test.queued, "got", length)
+		}
+	}
+}
+
+func TestWebhookPath(t *testing.T) {
+	b := &bot{}
+	if path := b.webhookPath(); path != "/web_hook" {
+		t.Error("Expected /web_hook, got ", path)
+	}
+
+	b.webhookSecret = "s3cret"
+	if path := b.webhookPath(); path != "/web_hook/s3cret" {
+		t.Error("Expected /web_hook/s3cret, got ", path)
+	}
+}
+
+func TestWebhookHandlerLimiter(t *testing.T) {
+	b := newTestWebhookBot(t)
+
+	// the webhooks of unknown accounts do not request the monobank api and keep the token of the limiter
+	limiter := rate.NewLimiter(rate.Every(time.Hour), 1)
+	b.clients[0].(*client).limiter = limiter
+
+	body := `{"type":"StatementItem","data":{"account":"fake","statementItem":{"id":"st1"}}}`
+	b.handleWebhook(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, b.webhookPath(), strings.NewReader(body)))
+
+	if !limiter.Allow() {
+		t.Error("Expected the token of the limiter")
+	}
+}